@@ -3,17 +3,22 @@ module url-shortener
 go 1.13
 
 require (
+	github.com/alicebob/miniredis/v2 v2.11.4
+	github.com/fergusstrange/embedded-postgres v1.19.0
 	github.com/go-chi/chi v4.0.3+incompatible
 	github.com/go-chi/render v1.0.1
 	github.com/go-redis/redis v6.15.7+incompatible
 	github.com/joeshaw/envdecode v0.0.0-20200121155833-099f1fc765bd
+	github.com/lib/pq v1.10.4
 	github.com/oklog/run v1.1.0
 	github.com/opentracing/opentracing-go v1.1.0
+	github.com/prometheus/client_golang v1.5.1
 	github.com/rs/zerolog v1.18.0
 	github.com/smartystreets/goconvey v1.6.4
 	github.com/speps/go-hashids v2.0.0+incompatible
-	github.com/stretchr/testify v1.4.0
+	github.com/stretchr/testify v1.7.0
 	github.com/uber/jaeger-client-go v2.22.1+incompatible
 	github.com/uber/jaeger-lib v2.2.0+incompatible // indirect
+	go.etcd.io/bbolt v1.3.4
 	go.uber.org/atomic v1.5.1 // indirect
 )
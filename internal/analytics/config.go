@@ -0,0 +1,5 @@
+package analytics
+
+type Config struct {
+	QueueSize int `env:"ANALYTICS_QUEUESIZE,default=4096"`
+}
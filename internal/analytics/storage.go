@@ -0,0 +1,12 @@
+package analytics
+
+import (
+	"context"
+	"time"
+)
+
+type Storage interface {
+	SaveHit(ctx context.Context, slug string, at time.Time) error
+	LoadHits(ctx context.Context, slug string, from time.Time, to time.Time) (int64, error)
+	LoadTotalHits(ctx context.Context, slug string) (int64, error)
+}
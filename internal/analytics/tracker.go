@@ -0,0 +1,100 @@
+package analytics
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"url-shortener/internal/logger"
+)
+
+type Counters struct {
+	Last24Hours int64
+	LastWeek    int64
+	AllTime     int64
+}
+
+type hit struct {
+	slug string
+	at   time.Time
+}
+
+//tracker records hits in the background, so the redirects don't wait for the storage
+type tracker struct {
+	storage Storage
+	hits    chan hit
+	quit    chan struct{}
+	once    sync.Once
+	now     func() time.Time
+}
+
+func (t *tracker) TrackHit(ctx context.Context, slug string) {
+	select {
+	case t.hits <- hit{slug: slug, at: t.now()}:
+	default:
+		logger.Ctx(ctx).Warn().Str("slug", slug).Msg("The hits queue is full, the hit has been dropped")
+	}
+}
+
+func (t *tracker) Stats(ctx context.Context, slug string) (*Counters, error) {
+	now := t.now()
+
+	day, err := t.storage.LoadHits(ctx, slug, now.Add(-24*time.Hour), now)
+	if err != nil {
+		return nil, err
+	}
+	week, err := t.storage.LoadHits(ctx, slug, now.Add(-7*24*time.Hour), now)
+	if err != nil {
+		return nil, err
+	}
+	total, err := t.storage.LoadTotalHits(ctx, slug)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Counters{
+		Last24Hours: day,
+		LastWeek:    week,
+		AllTime:     total,
+	}, nil
+}
+
+//Run saves the tracked hits until Stop is called, the hits left in the queue are saved before returning
+func (t *tracker) Run(ctx context.Context) error {
+	for {
+		select {
+		case h := <-t.hits:
+			t.save(ctx, h)
+		case <-t.quit:
+			for {
+				select {
+				case h := <-t.hits:
+					t.save(ctx, h)
+				default:
+					return nil
+				}
+			}
+		}
+	}
+}
+
+func (t *tracker) Stop() {
+	t.once.Do(func() {
+		close(t.quit)
+	})
+}
+
+func (t *tracker) save(ctx context.Context, h hit) {
+	if err := t.storage.SaveHit(ctx, h.slug, h.at); err != nil {
+		logger.Ctx(ctx).Error().Err(err).Str("slug", h.slug).Msg("Cannot save a hit")
+	}
+}
+
+func NewTracker(cfg *Config, storage Storage) *tracker {
+	return &tracker{
+		storage: storage,
+		hits:    make(chan hit, cfg.QueueSize),
+		quit:    make(chan struct{}),
+		now:     time.Now,
+	}
+}
@@ -0,0 +1,91 @@
+package analytics
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type mockStorage struct {
+	m *mock.Mock
+}
+
+func (s *mockStorage) SaveHit(ctx context.Context, slug string, at time.Time) error {
+	args := s.m.Called(ctx, slug, at)
+	return args.Error(0)
+}
+
+func (s *mockStorage) LoadHits(ctx context.Context, slug string, from time.Time, to time.Time) (int64, error) {
+	args := s.m.Called(ctx, slug, from, to)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (s *mockStorage) LoadTotalHits(ctx context.Context, slug string) (int64, error) {
+	args := s.m.Called(ctx, slug)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func TestTracker(t *testing.T) {
+	Convey("Test tracker", t, func() {
+		m := &mock.Mock{}
+		now := time.Date(2020, 3, 15, 10, 30, 0, 0, time.UTC)
+		tr := NewTracker(&Config{QueueSize: 2}, &mockStorage{m: m})
+		tr.now = func() time.Time { return now }
+
+		Convey("It saves the tracked hits", func() {
+			m.
+				On("SaveHit", mock.Anything, "abc", now).Return(nil).Once().
+				On("SaveHit", mock.Anything, "qwe", now).Return(errors.New("SaveHit error")).Once()
+
+			tr.TrackHit(context.TODO(), "abc")
+			tr.TrackHit(context.TODO(), "qwe")
+			tr.Stop()
+			assert.NoError(t, tr.Run(context.TODO()))
+
+			m.AssertExpectations(t)
+		})
+
+		Convey("It drops the hits if the queue is full", func() {
+			m.
+				On("SaveHit", mock.Anything, "abc", now).Return(nil).Twice()
+
+			tr.TrackHit(context.TODO(), "abc")
+			tr.TrackHit(context.TODO(), "abc")
+			tr.TrackHit(context.TODO(), "abc")
+			tr.Stop()
+			tr.Stop()
+			assert.NoError(t, tr.Run(context.TODO()))
+
+			m.AssertExpectations(t)
+		})
+
+		Convey("It returns the counters", func() {
+			m.
+				On("LoadHits", mock.Anything, "abc", now.Add(-24*time.Hour), now).Return(int64(3), nil).
+				On("LoadHits", mock.Anything, "abc", now.Add(-7*24*time.Hour), now).Return(int64(10), nil).
+				On("LoadTotalHits", mock.Anything, "abc").Return(int64(42), nil)
+
+			counters, err := tr.Stats(context.TODO(), "abc")
+
+			m.AssertExpectations(t)
+			assert.NoError(t, err)
+			assert.Equal(t, &Counters{Last24Hours: 3, LastWeek: 10, AllTime: 42}, counters)
+		})
+
+		Convey("It fails if the storage has failed", func() {
+			m.
+				On("LoadHits", mock.Anything, "abc", now.Add(-24*time.Hour), now).Return(int64(3), nil).
+				On("LoadHits", mock.Anything, "abc", now.Add(-7*24*time.Hour), now).Return(int64(0), errors.New("LoadHits error"))
+
+			_, err := tr.Stats(context.TODO(), "abc")
+
+			m.AssertExpectations(t)
+			assert.EqualError(t, err, "LoadHits error")
+		})
+	})
+}
@@ -0,0 +1,7 @@
+package auth
+
+type Config struct {
+	Disabled bool `env:"AUTH_DISABLED,default=false"`
+	//Keys are the static API keys in the form of name:sha256:scope,scope where sha256 is the hex digest of the key
+	Keys []string `env:"AUTH_KEYS"`
+}
@@ -0,0 +1,99 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"url-shortener/internal/storage"
+)
+
+const (
+	ScopeCreate = "links:create"
+	ScopeRead   = "links:read"
+	ScopeUpdate = "links:update"
+	ScopeDelete = "links:delete"
+	//ScopeAll grants every scope
+	ScopeAll = "*"
+)
+
+var (
+	ErrMissingKey   = errors.New("The API key is missing")
+	ErrInvalidKey   = errors.New("The API key is invalid")
+	ErrMissingScope = errors.New("The API key doesn't grant the access")
+)
+
+//Key is the API key which the request has been authenticated with
+type Key struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+func (k *Key) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope || s == ScopeAll {
+			return true
+		}
+	}
+	return false
+}
+
+//HashKey returns the digest which the key is kept as, the keys themselves are never stored
+func HashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+//keyStorageKey is where the key issued without restarting the service is kept, e.g. with
+//SET apikey:$sha256 '{"name":"marketing","scopes":["links:create"]}'
+func keyStorageKey(hash string) string {
+	return "apikey:" + hash
+}
+
+//keys finds the API keys among the configured ones first, then in the storage
+type keys struct {
+	static  map[string]*Key
+	storage storage.Storage
+}
+
+func (k *keys) find(ctx context.Context, key string) (*Key, error) {
+	hash := HashKey(key)
+	if found, ok := k.static[hash]; ok {
+		return found, nil
+	}
+
+	value, err := k.storage.LoadValue(ctx, keyStorageKey(hash))
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, ErrInvalidKey
+	}
+	if err != nil {
+		return nil, err
+	}
+	found := &Key{}
+	if err := json.Unmarshal([]byte(value), found); err != nil {
+		return nil, fmt.Errorf("The API key record is corrupted: %w", err)
+	}
+	return found, nil
+}
+
+func parseKeys(definitions []string) (map[string]*Key, error) {
+	keys := make(map[string]*Key, len(definitions))
+	for _, definition := range definitions {
+		parts := strings.SplitN(definition, ":", 3)
+		if len(parts) != 3 || parts[0] == "" || len(parts[1]) != sha256.Size*2 {
+			return nil, fmt.Errorf("The API key %q must be defined as name:sha256:scope,scope", parts[0])
+		}
+		if _, err := hex.DecodeString(parts[1]); err != nil {
+			return nil, fmt.Errorf("The digest of the API key %q is invalid: %w", parts[0], err)
+		}
+		keys[strings.ToLower(parts[1])] = &Key{
+			Name:   parts[0],
+			Scopes: strings.Split(parts[2], ","),
+		}
+	}
+	return keys, nil
+}
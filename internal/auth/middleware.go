@@ -0,0 +1,117 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/render"
+
+	"url-shortener/internal/chi_utils"
+	httplogger "url-shortener/internal/logger/http"
+	"url-shortener/internal/storage"
+)
+
+//KeyHeader carries the API key unless it's given as the bearer token
+const KeyHeader = "X-API-Key"
+
+type ctxKey struct{}
+
+//WithKey returns the context of the request authenticated with the key
+func WithKey(ctx context.Context, key *Key) context.Context {
+	return context.WithValue(ctx, ctxKey{}, key)
+}
+
+//FromContext returns the key which the request has been authenticated with
+func FromContext(ctx context.Context) (*Key, bool) {
+	key, ok := ctx.Value(ctxKey{}).(*Key)
+	return key, ok
+}
+
+//KeyName returns the name of the key which the request has been authenticated with, it's empty if the
+//authentication is disabled
+func KeyName(ctx context.Context) string {
+	if key, ok := FromContext(ctx); ok {
+		return key.Name
+	}
+	return ""
+}
+
+type authenticator struct {
+	disabled bool
+	keys     *keys
+}
+
+//Require lets through only the requests with the API keys granting the scope
+func (a *authenticator) Require(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			if a.disabled {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			raw := requestKey(r)
+			if raw == "" {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				render.Render(w, r, chi_utils.Unauthorized(ErrMissingKey))
+				return
+			}
+			key, err := a.keys.find(r.Context(), raw)
+			switch {
+			case errors.Is(err, ErrInvalidKey):
+				httplogger.FromRequest(r).Debug().Err(err).Msg("The request has been rejected")
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				render.Render(w, r, chi_utils.Unauthorized(ErrInvalidKey))
+				return
+			case errors.Is(err, storage.ErrUnavailable):
+				httplogger.FromRequest(r).Error().Err(err).Msg("Cannot find the API key")
+				render.Render(w, r, chi_utils.ServiceUnavailable(storage.ErrUnavailable))
+				return
+			case errors.Is(err, context.DeadlineExceeded):
+				httplogger.FromRequest(r).Error().Err(err).Msg("Cannot find the API key")
+				render.Render(w, r, chi_utils.GatewayTimeout(err))
+				return
+			case err != nil:
+				httplogger.FromRequest(r).Error().Err(err).Msg("Cannot find the API key")
+				render.Render(w, r, chi_utils.InternalServerError(err))
+				return
+			}
+
+			if !key.HasScope(scope) {
+				httplogger.FromRequest(r).Debug().Str("key", key.Name).Str("scope", scope).Msg("The scope isn't granted")
+				render.Render(w, r, chi_utils.Forbidden(ErrMissingScope))
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(WithKey(r.Context(), key)))
+		}
+		return http.HandlerFunc(fn)
+	}
+}
+
+func requestKey(r *http.Request) string {
+	if key := r.Header.Get(KeyHeader); key != "" {
+		return key
+	}
+	authorization := r.Header.Get("Authorization")
+	if strings.HasPrefix(authorization, "Bearer ") {
+		return strings.TrimPrefix(authorization, "Bearer ")
+	}
+	return ""
+}
+
+//NewAuthenticator checks the API keys against the configured ones and the ones kept in the storage
+func NewAuthenticator(cfg *Config, storage storage.Storage) (*authenticator, error) {
+	static, err := parseKeys(cfg.Keys)
+	if err != nil {
+		return nil, err
+	}
+	return &authenticator{
+		disabled: cfg.Disabled,
+		keys: &keys{
+			static:  static,
+			storage: storage,
+		},
+	}, nil
+}
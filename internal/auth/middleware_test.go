@@ -0,0 +1,99 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"url-shortener/internal/storage"
+)
+
+type mockStorage struct {
+	storage.Storage
+	m *mock.Mock
+}
+
+func (s *mockStorage) LoadValue(ctx context.Context, key string) (string, error) {
+	args := s.m.Called(ctx, key)
+	return args.String(0), args.Error(1)
+}
+
+func TestAuthenticator(t *testing.T) {
+	Convey("Test the authentication", t, func() {
+		m := &mock.Mock{}
+		a, err := NewAuthenticator(&Config{
+			Keys: []string{
+				fmt.Sprintf("marketing:%s:%s", HashKey("secret"), ScopeCreate),
+				fmt.Sprintf("ops:%s:%s", HashKey("root"), ScopeAll),
+			},
+		}, &mockStorage{m: m})
+		assert.NoError(t, err)
+
+		var authenticated *Key
+		handler := a.Require(ScopeCreate)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			authenticated, _ = FromContext(r.Context())
+		}))
+		request := func(header string, value string) int {
+			req := httptest.NewRequest(http.MethodPost, "http://blablabla.me/", nil)
+			if header != "" {
+				req.Header.Set(header, value)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			return w.Code
+		}
+
+		Convey("It rejects the request without the key", func() {
+			assert.Equal(t, http.StatusUnauthorized, request("", ""))
+			assert.Equal(t, http.StatusUnauthorized, request("Authorization", "Basic c2VjcmV0"))
+		})
+
+		Convey("It accepts the configured keys", func() {
+			assert.Equal(t, http.StatusOK, request(KeyHeader, "secret"))
+			assert.Equal(t, &Key{Name: "marketing", Scopes: []string{ScopeCreate}}, authenticated)
+
+			assert.Equal(t, http.StatusOK, request("Authorization", "Bearer root"))
+			assert.Equal(t, "ops", authenticated.Name)
+		})
+
+		Convey("It looks up the unknown keys in the storage", func() {
+			m.
+				On("LoadValue", mock.Anything, "apikey:"+HashKey("issued")).Return(`{"name":"partner","scopes":["links:create"]}`, nil).
+				On("LoadValue", mock.Anything, "apikey:"+HashKey("readonly")).Return(`{"name":"reports","scopes":["links:read"]}`, nil).
+				On("LoadValue", mock.Anything, "apikey:"+HashKey("forged")).Return("", storage.ErrNotFound).
+				On("LoadValue", mock.Anything, "apikey:"+HashKey("later")).Return("", fmt.Errorf("%w: dial tcp", storage.ErrUnavailable))
+
+			assert.Equal(t, http.StatusOK, request(KeyHeader, "issued"))
+			assert.Equal(t, "partner", authenticated.Name)
+			assert.Equal(t, http.StatusForbidden, request(KeyHeader, "readonly"))
+			assert.Equal(t, http.StatusUnauthorized, request(KeyHeader, "forged"))
+			assert.Equal(t, http.StatusServiceUnavailable, request(KeyHeader, "later"))
+			m.AssertExpectations(t)
+		})
+
+		Convey("It lets everything through if it's disabled", func() {
+			a.disabled = true
+			assert.Equal(t, http.StatusOK, request("", ""))
+			assert.Nil(t, authenticated)
+		})
+	})
+
+	Convey("The invalid keys are rejected", t, func() {
+		for _, key := range []string{
+			"marketing",
+			"marketing:" + HashKey("secret"),
+			":" + HashKey("secret") + ":" + ScopeCreate,
+			"marketing:abc:" + ScopeCreate,
+			fmt.Sprintf("marketing:%64s:%s", "z", ScopeCreate),
+		} {
+			_, err := NewAuthenticator(&Config{Keys: []string{key}}, nil)
+			assert.Error(t, err, key)
+		}
+	})
+}
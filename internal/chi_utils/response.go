@@ -19,44 +19,83 @@ func (e *errResponse) Render(w http.ResponseWriter, r *http.Request) error {
 	return nil
 }
 
-func InvalidRequest(err error) render.Renderer {
+func newErrResponse(code int, description string) render.Renderer {
 	return &errResponse{
-		HTTPStatusCode: http.StatusBadRequest,
+		HTTPStatusCode: code,
 		ErrorResponse: protocol.ErrorResponse{
 			Errors: []protocol.Error{
 				protocol.Error{
-					Code:        http.StatusBadRequest,
-					Description: err.Error(),
+					Code:        int32(code),
+					Description: description,
 				},
 			},
 		},
 	}
 }
 
-func InternalServerError(err error) render.Renderer {
-	return &errResponse{
-		HTTPStatusCode: http.StatusInternalServerError,
-		ErrorResponse: protocol.ErrorResponse{
-			Errors: []protocol.Error{
-				protocol.Error{
-					Code:        http.StatusInternalServerError,
-					Description: err.Error(),
-				},
-			},
-		},
+//Errors returns the errors of the response made by this package, so they can be a part of another response
+func Errors(response render.Renderer) []protocol.Error {
+	if e, ok := response.(*errResponse); ok {
+		return e.Errors
 	}
+	return nil
+}
+
+func InvalidRequest(err error) render.Renderer {
+	return newErrResponse(http.StatusBadRequest, err.Error())
+}
+
+func Unauthorized(err error) render.Renderer {
+	return newErrResponse(http.StatusUnauthorized, err.Error())
+}
+
+func Forbidden(err error) render.Renderer {
+	return newErrResponse(http.StatusForbidden, err.Error())
+}
+
+func NotFound(err error) render.Renderer {
+	return newErrResponse(http.StatusNotFound, err.Error())
+}
+
+func RequestEntityTooLarge(err error) render.Renderer {
+	return newErrResponse(http.StatusRequestEntityTooLarge, err.Error())
+}
+
+func Conflict(err error) render.Renderer {
+	return newErrResponse(http.StatusConflict, err.Error())
+}
+
+func Gone(err error) render.Renderer {
+	return newErrResponse(http.StatusGone, err.Error())
+}
+
+func UnprocessableEntity(err error) render.Renderer {
+	return newErrResponse(http.StatusUnprocessableEntity, err.Error())
+}
+
+//Rejected reports the valid request which isn't accepted for the reason
+func Rejected(err error, reason string) render.Renderer {
+	response := newErrResponse(http.StatusUnprocessableEntity, err.Error()).(*errResponse)
+	response.Errors[0].Reason = reason
+	return response
+}
+
+func TooManyRequests(err error) render.Renderer {
+	return newErrResponse(http.StatusTooManyRequests, err.Error())
+}
+
+func InternalServerError(err error) render.Renderer {
+	return newErrResponse(http.StatusInternalServerError, err.Error())
 }
 
 func NotImplementedError() render.Renderer {
-	return &errResponse{
-		HTTPStatusCode: http.StatusNotImplemented,
-		ErrorResponse: protocol.ErrorResponse{
-			Errors: []protocol.Error{
-				protocol.Error{
-					Code:        http.StatusNotImplemented,
-					Description: http.StatusText(http.StatusNotImplemented),
-				},
-			},
-		},
-	}
+	return newErrResponse(http.StatusNotImplemented, http.StatusText(http.StatusNotImplemented))
+}
+
+func ServiceUnavailable(err error) render.Renderer {
+	return newErrResponse(http.StatusServiceUnavailable, err.Error())
+}
+
+func GatewayTimeout(err error) render.Renderer {
+	return newErrResponse(http.StatusGatewayTimeout, err.Error())
 }
@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/render"
+
+	"url-shortener/internal/chi_utils"
+	httplogger "url-shortener/internal/logger/http"
+	"url-shortener/internal/slugs"
+	"url-shortener/pkg/protocol"
+)
+
+const ndjsonContentType = "application/x-ndjson"
+
+var (
+	errEmptyBatch    = errors.New("The batch is empty")
+	errNotArray      = errors.New("The batch must be a JSON array")
+	errBatchTooLarge = errors.New("The batch is too large")
+)
+
+//CreateShortLinks creates the links of the batch independently, so the invalid requests don't prevent creating
+//the rest of the links. The links with the generated slugs are registered all at once, the deduplicated ones are
+//registered one by one, since each of them has to be looked up.
+func (s *server) CreateShortLinks(w http.ResponseWriter, r *http.Request) {
+	body := &limitedBody{ReadCloser: http.MaxBytesReader(w, r.Body, s.batchMaxBytes), limit: s.batchMaxBytes}
+	r.Body = body
+	items, err := decodeBatch(r, s.batchLimit)
+	if err != nil && body.exceeded() {
+		render.Render(w, r, chi_utils.RequestEntityTooLarge(fmt.Errorf("%w: it mustn't be larger than %d bytes", errBatchTooLarge, s.batchMaxBytes)))
+		return
+	}
+	if err != nil {
+		render.Render(w, r, chi_utils.InvalidRequest(err))
+		return
+	}
+
+	now := time.Now()
+	results := make([]protocol.CreateShortLinkResult, len(items))
+	links := make([]*slugs.Link, 0, len(items))
+	positions := make([]int, 0, len(items))
+	for i, item := range items {
+		request := protocol.CreateShortLinkRequest{}
+		if err := json.Unmarshal(item, &request); err != nil {
+			results[i].Errors = chi_utils.Errors(chi_utils.InvalidRequest(err))
+			continue
+		}
+		if err := request.Bind(r); err != nil {
+			results[i].Errors = chi_utils.Errors(chi_utils.InvalidRequest(err))
+			continue
+		}
+		if err := s.checkURL(r, request.URL); err != nil {
+			results[i].Errors = chi_utils.Errors(urlPolicyError(err))
+			continue
+		}
+		if request.Slug == "" && !request.Dedupe {
+			links = append(links, newLink(r.Context(), &request, now))
+			positions = append(positions, i)
+			continue
+		}
+
+		slug, err := s.registerURL(r.Context(), &request)
+		if err != nil {
+			logRegistryError(r, err).Str("url", request.URL).Str("slug", request.Slug).Msg("Cannot register the url")
+			results[i].Errors = chi_utils.Errors(registryError(err))
+			continue
+		}
+		results[i].Slug = slug
+	}
+
+	if len(links) > 0 {
+		registrations, err := s.registry.RegisterURLs(r.Context(), links)
+		if err != nil {
+			logRegistryError(r, err).Int("count", len(links)).Msg("Cannot register the batch")
+		}
+		for n, i := range positions {
+			switch {
+			case err != nil:
+				results[i].Errors = chi_utils.Errors(registryError(err))
+			case registrations[n].Err != nil:
+				logRegistryError(r, registrations[n].Err).Str("url", links[n].URL).Msg("Cannot register the url")
+				results[i].Errors = chi_utils.Errors(registryError(registrations[n].Err))
+			default:
+				results[i].Slug = registrations[n].Slug
+			}
+		}
+	}
+	httplogger.FromRequest(r).Debug().Int("count", len(items)).Msg("The batch has been processed")
+
+	response := protocol.CreateShortLinksResponse{}
+	response.Data = results
+	render.Respond(w, r, &response)
+}
+
+//limitedBody tells the body cut by http.MaxBytesReader from the malformed one
+type limitedBody struct {
+	io.ReadCloser
+	limit int64
+	read  int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.read += int64(n)
+	return n, err
+}
+
+func (b *limitedBody) exceeded() bool {
+	return b.read >= b.limit
+}
+
+//decodeBatch splits the body into the requests, which are either the items of a JSON array or the JSON values
+//separated by new lines. Both are read item by item, so no more than one item over the limit is decoded.
+func decodeBatch(r *http.Request, limit int) ([]json.RawMessage, error) {
+	decoder := json.NewDecoder(r.Body)
+	items := []json.RawMessage{}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	array := mediaType != ndjsonContentType
+	if array {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		if delim, ok := token.(json.Delim); !ok || delim != '[' {
+			return nil, errNotArray
+		}
+	}
+	for len(items) <= limit {
+		if array && !decoder.More() {
+			if _, err := decoder.Token(); err != nil {
+				return nil, err
+			}
+			break
+		}
+		item := json.RawMessage{}
+		err := decoder.Decode(&item)
+		if err == io.EOF && !array {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+
+	if len(items) == 0 {
+		return nil, errEmptyBatch
+	}
+	if len(items) > limit {
+		return nil, fmt.Errorf("The batch mustn't have more than %d links", limit)
+	}
+	return items, nil
+}
@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"url-shortener/internal/slugs"
+	"url-shortener/internal/storage"
+	"url-shortener/internal/urlpolicy"
+)
+
+func TestCreateShortLinks(t *testing.T) {
+	Convey("The handler works correctly", t, func() {
+		m := &mock.Mock{}
+		w := httptest.NewRecorder()
+		srv := server{
+			registry: &mockRegistry{
+				m: m,
+			},
+			batchLimit:    3,
+			batchMaxBytes: 1024,
+		}
+		newRequest := func(contentType string, body string) *http.Request {
+			req := httptest.NewRequest(http.MethodPost, "http://blablabla.me/api/links/batch", strings.NewReader(body))
+			req.Header.Set("Content-Type", contentType)
+			return req
+		}
+
+		Convey("It rejects the malformed batch", func() {
+			srv.CreateShortLinks(w, newRequest("application/json", `{"url": "http://google.com"}`))
+
+			m.AssertExpectations(t)
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+		})
+		Convey("It rejects the empty batch", func() {
+			srv.CreateShortLinks(w, newRequest("application/json", `[]`))
+
+			m.AssertExpectations(t)
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+		})
+		Convey("It rejects the batch which is too large", func() {
+			srv.CreateShortLinks(w, newRequest("application/x-ndjson", strings.Repeat(`{"url": "http://google.com"}`+"\n", 4)))
+
+			m.AssertExpectations(t)
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			resp := w.Result()
+			body, err := ioutil.ReadAll(resp.Body)
+			assert.NoError(t, err)
+			assert.JSONEq(t,
+				`{"errors": [{"code": 400, "description": "The batch mustn't have more than 3 links"}]}`,
+				string(body),
+			)
+		})
+		Convey("It stops reading the array over the limit", func() {
+			srv.CreateShortLinks(w, newRequest("application/json", `[`+strings.Repeat(`{"url": "http://google.com"}, `, 4)+`not json`))
+
+			m.AssertExpectations(t)
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			body, err := ioutil.ReadAll(w.Result().Body)
+			assert.NoError(t, err)
+			assert.JSONEq(t,
+				`{"errors": [{"code": 400, "description": "The batch mustn't have more than 3 links"}]}`,
+				string(body),
+			)
+		})
+		Convey("It rejects the body which is too large", func() {
+			srv.CreateShortLinks(w, newRequest("application/json", `[{"url": "http://google.com/`+strings.Repeat("a", 1024)+`"}]`))
+
+			m.AssertExpectations(t)
+			assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+			body, err := ioutil.ReadAll(w.Result().Body)
+			assert.NoError(t, err)
+			assert.JSONEq(t,
+				`{"errors": [{"code": 413, "description": "The batch is too large: it mustn't be larger than 1024 bytes"}]}`,
+				string(body),
+			)
+		})
+		Convey("It rejects the truncated array", func() {
+			srv.CreateShortLinks(w, newRequest("application/json", `[{"url": "http://google.com"}`))
+
+			m.AssertExpectations(t)
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+		})
+		Convey("It reports the results of every link", func() {
+			m.
+				On("RegisterCustomURL", mock.Anything, "golang", &slugs.Link{URL: "http://google.com/golang"}).Return(slugs.ErrSlugIsTaken).
+				On("RegisterURLs", mock.Anything, []*slugs.Link{{URL: "http://google.com/abc"}}).Return([]slugs.Registration{{Slug: "qwe"}}, nil)
+
+			srv.CreateShortLinks(w, newRequest("application/json", `
+                [
+                    {"url": ""},
+                    {"url": "http://google.com/golang", "slug": "golang"},
+                    {"url": "http://google.com/abc"}
+                ]`,
+			))
+
+			m.AssertExpectations(t)
+			assert.Equal(t, http.StatusOK, w.Code)
+			resp := w.Result()
+			body, err := ioutil.ReadAll(resp.Body)
+			assert.NoError(t, err)
+			assert.JSONEq(t,
+				`
+        {
+            "data":
+            [
+                {"errors": [{"code": 400, "description": "The URL mustn't be empty"}]},
+                {"errors": [{"code": 409, "description": "The slug is already taken"}]},
+                {"slug": "qwe"}
+            ]
+        }`,
+				string(body),
+			)
+		})
+		Convey("It reports the URLs which violate the policy", func() {
+			srv.urlPolicy = &mockPolicy{m: m}
+			m.
+				On("Check", mock.Anything, "ftp://google.com", "blablabla.me").Return(fmt.Errorf("%w: ftp", urlpolicy.ErrSchemeNotAllowed)).
+				On("Check", mock.Anything, "http://google.com/abc", "blablabla.me").Return(nil).
+				On("RegisterURLs", mock.Anything, []*slugs.Link{{URL: "http://google.com/abc"}}).Return([]slugs.Registration{{Slug: "qwe"}}, nil)
+
+			srv.CreateShortLinks(w, newRequest("application/json", `[{"url": "ftp://google.com"}, {"url": "http://google.com/abc"}]`))
+
+			m.AssertExpectations(t)
+			assert.Equal(t, http.StatusOK, w.Code)
+			resp := w.Result()
+			body, err := ioutil.ReadAll(resp.Body)
+			assert.NoError(t, err)
+			assert.JSONEq(t,
+				`
+        {
+            "data":
+            [
+                {"errors": [{"code": 422, "reason": "scheme_not_allowed", "description": "The scheme of the URL isn't allowed: ftp"}]},
+                {"slug": "qwe"}
+            ]
+        }`,
+				string(body),
+			)
+		})
+		Convey("It deduplicates the links one by one", func() {
+			m.
+				On("RegisterUniqueURL", mock.Anything, &slugs.Link{URL: "http://google.com/abc"}).Return("qwe", nil)
+
+			srv.CreateShortLinks(w, newRequest("application/json", `[{"url": "http://google.com/abc", "dedupe": true}]`))
+
+			m.AssertExpectations(t)
+			assert.Equal(t, http.StatusOK, w.Code)
+			resp := w.Result()
+			body, err := ioutil.ReadAll(resp.Body)
+			assert.NoError(t, err)
+			assert.JSONEq(t, `{"data": [{"slug": "qwe"}]}`, string(body))
+		})
+		Convey("It reads the links separated by new lines", func() {
+			m.
+				On("RegisterURLs", mock.Anything, []*slugs.Link{{URL: "http://google.com/abc"}, {URL: "http://google.com/xyz"}}).
+				Return([]slugs.Registration{{Slug: "qwe"}, {Err: slugs.ErrInvalidExpiration}}, nil)
+
+			srv.CreateShortLinks(w, newRequest("application/x-ndjson; charset=utf-8", `{"url": "http://google.com/abc"}
+{"url": "http://google.com/xyz"}
+{"url": 42}`,
+			))
+
+			m.AssertExpectations(t)
+			assert.Equal(t, http.StatusOK, w.Code)
+			resp := w.Result()
+			body, err := ioutil.ReadAll(resp.Body)
+			assert.NoError(t, err)
+			assert.JSONEq(t,
+				`
+        {
+            "data":
+            [
+                {"slug": "qwe"},
+                {"errors": [{"code": 400, "description": "The expiration time must be in the future"}]},
+                {"errors": [{"code": 400, "description": "json: cannot unmarshal number into Go struct field CreateShortLinkRequest.url of type string"}]}
+            ]
+        }`,
+				string(body),
+			)
+		})
+		Convey("It reports the failure of the registry for every generated link", func() {
+			m.
+				On("RegisterURLs", mock.Anything, mock.Anything).Return(nil, fmt.Errorf("%w: dial tcp", storage.ErrUnavailable))
+
+			srv.CreateShortLinks(w, newRequest("application/json", `[{"url": "http://google.com/abc"}, {"url": "http://google.com/xyz"}]`))
+
+			m.AssertExpectations(t)
+			assert.Equal(t, http.StatusOK, w.Code)
+			resp := w.Result()
+			body, err := ioutil.ReadAll(resp.Body)
+			assert.NoError(t, err)
+			assert.JSONEq(t,
+				`
+        {
+            "data":
+            [
+                {"errors": [{"code": 503, "description": "The storage is unavailable"}]},
+                {"errors": [{"code": 503, "description": "The storage is unavailable"}]}
+            ]
+        }`,
+				string(body),
+			)
+		})
+		Convey("It doesn't call the registry if there is nothing to register", func() {
+			srv.CreateShortLinks(w, newRequest("application/json", `[{"url": "http://google.com/abc", "expires_in": -1}]`))
+
+			m.AssertExpectations(t)
+			assert.Equal(t, http.StatusOK, w.Code)
+			m.AssertNotCalled(t, "RegisterURLs", mock.Anything, mock.Anything)
+		})
+	})
+}
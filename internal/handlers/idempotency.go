@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/render"
+
+	"url-shortener/internal/auth"
+	"url-shortener/internal/chi_utils"
+	"url-shortener/internal/idempotency"
+	httplogger "url-shortener/internal/logger/http"
+	"url-shortener/pkg/protocol"
+)
+
+//createShortLinkOnce answers the replays of the request with the slug created for the first one, so the retries
+//of the clients don't produce duplicate links
+func (s *server) createShortLinkOnce(w http.ResponseWriter, r *http.Request, key string, request *protocol.CreateShortLinkRequest) {
+	if err := idempotency.ValidateKey(key); err != nil {
+		render.Render(w, r, chi_utils.InvalidRequest(err))
+		return
+	}
+	fingerprint, err := requestFingerprint(auth.KeyName(r.Context()), request)
+	if err != nil {
+		httplogger.FromRequest(r).Error().Err(err).Msg("Cannot fingerprint the request")
+		render.Render(w, r, chi_utils.InternalServerError(errInternal))
+		return
+	}
+
+	slug, err := s.idempotency.Reserve(r.Context(), key, fingerprint)
+	if err != nil {
+		logRegistryError(r, err).Str("key", key).Msg("Cannot reserve the idempotency key")
+		render.Render(w, r, registryError(err))
+		return
+	}
+	if slug != "" {
+		httplogger.FromRequest(r).Debug().Str("key", key).Str("slug", slug).Msg("The request has been replayed")
+		respondSlug(w, r, slug)
+		return
+	}
+
+	slug, err = s.registerURL(r.Context(), request)
+	if err != nil {
+		logRegistryError(r, err).Str("url", request.URL).Str("slug", request.Slug).Msg("Cannot register the url")
+		if err := s.idempotency.Release(r.Context(), key, fingerprint); err != nil {
+			// The retries are answered with 409 until the reservation expires
+			httplogger.FromRequest(r).Error().Err(err).Str("key", key).Msg("Cannot release the idempotency key")
+		}
+		render.Render(w, r, registryError(err))
+		return
+	}
+
+	if err := s.idempotency.Complete(r.Context(), key, fingerprint, slug); err != nil {
+		// The link has been created anyway, so only the replays of the request aren't recognized
+		logRegistryError(r, err).Str("key", key).Str("slug", slug).Msg("Cannot complete the idempotency key")
+	}
+	respondSlug(w, r, slug)
+}
+
+//requestFingerprint tells the replays of the request from the other requests with the same idempotency key, the
+//same request made with another API key isn't a replay
+func requestFingerprint(creator string, request *protocol.CreateShortLinkRequest) (string, error) {
+	data, err := json.Marshal(request)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(append([]byte(creator+"\n"), data...))
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/render"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"url-shortener/internal/auth"
+	"url-shortener/internal/idempotency"
+	"url-shortener/internal/slugs"
+	"url-shortener/internal/storage"
+	"url-shortener/internal/storage/memory"
+	"url-shortener/pkg/protocol"
+)
+
+type mockKeeper struct {
+	m *mock.Mock
+}
+
+func (k *mockKeeper) Reserve(ctx context.Context, key string, fingerprint string) (string, error) {
+	args := k.m.Called(ctx, key, fingerprint)
+	return args.String(0), args.Error(1)
+}
+
+func (k *mockKeeper) Complete(ctx context.Context, key string, fingerprint string, slug string) error {
+	return k.m.Called(ctx, key, fingerprint, slug).Error(0)
+}
+
+func (k *mockKeeper) Release(ctx context.Context, key string, fingerprint string) error {
+	return k.m.Called(ctx, key, fingerprint).Error(0)
+}
+
+func TestCreateShortLinkOnce(t *testing.T) {
+	Convey("The handler works correctly", t, func() {
+		m := &mock.Mock{}
+		req := httptest.NewRequest(http.MethodPost, "http://blablabla.me/", nil)
+		req.Header.Set(protocol.IdempotencyKeyHeader, "retry-42")
+		w := httptest.NewRecorder()
+		srv := server{
+			registry: &mockRegistry{
+				m: m,
+			},
+			idempotency: &mockKeeper{
+				m: m,
+			},
+			bind: func(r *http.Request, v render.Binder) error {
+				v.(*protocol.CreateShortLinkRequest).URL = "http://google.com/abc"
+				return nil
+			},
+		}
+		fingerprint, err := requestFingerprint("", &protocol.CreateShortLinkRequest{URL: "http://google.com/abc"})
+		assert.NoError(t, err)
+
+		Convey("It rejects the invalid key", func() {
+			req.Header.Set(protocol.IdempotencyKeyHeader, strings.Repeat("x", 256))
+
+			srv.CreateShortLink(w, req)
+
+			m.AssertExpectations(t)
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+		})
+		Convey("It replays the original response", func() {
+			m.
+				On("Reserve", mock.Anything, "retry-42", fingerprint).Return("qwe", nil)
+
+			srv.CreateShortLink(w, req)
+
+			m.AssertExpectations(t)
+			assert.Equal(t, http.StatusOK, w.Code)
+			body, err := ioutil.ReadAll(w.Result().Body)
+			assert.NoError(t, err)
+			assert.JSONEq(t, `{"data": {"slug": "qwe"}}`, string(body))
+		})
+		Convey("It rejects the replay with another body", func() {
+			m.
+				On("Reserve", mock.Anything, "retry-42", fingerprint).Return("", idempotency.ErrKeyReused)
+
+			srv.CreateShortLink(w, req)
+
+			m.AssertExpectations(t)
+			assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		})
+		Convey("It doesn't create the link while a replay is in progress", func() {
+			m.
+				On("Reserve", mock.Anything, "retry-42", fingerprint).Return("", idempotency.ErrInProgress)
+
+			srv.CreateShortLink(w, req)
+
+			m.AssertExpectations(t)
+			assert.Equal(t, http.StatusConflict, w.Code)
+		})
+		Convey("It fails if the key cannot be reserved", func() {
+			m.
+				On("Reserve", mock.Anything, "retry-42", fingerprint).Return("", errors.New("Reserve error"))
+
+			srv.CreateShortLink(w, req)
+
+			m.AssertExpectations(t)
+			assert.Equal(t, http.StatusInternalServerError, w.Code)
+		})
+		Convey("It saves the slug of the new link", func() {
+			m.
+				On("Reserve", mock.Anything, "retry-42", fingerprint).Return("", nil).
+				On("RegisterURL", mock.Anything, &slugs.Link{URL: "http://google.com/abc"}).Return("qwe", nil).
+				On("Complete", mock.Anything, "retry-42", fingerprint, "qwe").Return(nil)
+
+			srv.CreateShortLink(w, req)
+
+			m.AssertExpectations(t)
+			assert.Equal(t, http.StatusOK, w.Code)
+			body, err := ioutil.ReadAll(w.Result().Body)
+			assert.NoError(t, err)
+			assert.JSONEq(t, `{"data": {"slug": "qwe"}}`, string(body))
+		})
+		Convey("It releases the key if the link cannot be created", func() {
+			m.
+				On("Reserve", mock.Anything, "retry-42", fingerprint).Return("", nil).
+				On("RegisterURL", mock.Anything, &slugs.Link{URL: "http://google.com/abc"}).Return("", storage.ErrUnavailable).
+				On("Release", mock.Anything, "retry-42", fingerprint).Return(nil)
+
+			srv.CreateShortLink(w, req)
+
+			m.AssertExpectations(t)
+			assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+		})
+		Convey("It returns the new slug even if the key cannot be completed", func() {
+			m.
+				On("Reserve", mock.Anything, "retry-42", fingerprint).Return("", nil).
+				On("RegisterURL", mock.Anything, &slugs.Link{URL: "http://google.com/abc"}).Return("qwe", nil).
+				On("Complete", mock.Anything, "retry-42", fingerprint, "qwe").Return(idempotency.ErrKeyReleased)
+
+			srv.CreateShortLink(w, req)
+
+			m.AssertExpectations(t)
+			assert.Equal(t, http.StatusOK, w.Code)
+			body, err := ioutil.ReadAll(w.Result().Body)
+			assert.NoError(t, err)
+			assert.JSONEq(t, `{"data": {"slug": "qwe"}}`, string(body))
+		})
+	})
+}
+
+func TestCreateShortLinkOnceByAPIKeys(t *testing.T) {
+	Convey("The clients with different API keys may use the same idempotency key", t, func() {
+		m := &mock.Mock{}
+		srv := server{
+			registry: &mockRegistry{
+				m: m,
+			},
+			idempotency: idempotency.NewKeeper(&idempotency.Config{Window: time.Hour, PendingTimeout: time.Minute}, memory.NewStorage()),
+			bind: func(r *http.Request, v render.Binder) error {
+				v.(*protocol.CreateShortLinkRequest).URL = "http://google.com/abc"
+				return nil
+			},
+		}
+		create := func(name string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodPost, "http://blablabla.me/", nil)
+			req.Header.Set(protocol.IdempotencyKeyHeader, "retry-42")
+			req = req.WithContext(auth.WithKey(req.Context(), &auth.Key{Name: name}))
+			w := httptest.NewRecorder()
+			srv.CreateShortLink(w, req)
+			return w
+		}
+		m.
+			On("RegisterURL", mock.Anything, mock.MatchedBy(func(link *slugs.Link) bool { return link.Creator == "marketing" })).Return("qwe", nil).Once().
+			On("RegisterURL", mock.Anything, mock.MatchedBy(func(link *slugs.Link) bool { return link.Creator == "support" })).Return("asd", nil).Once()
+
+		for _, w := range []*httptest.ResponseRecorder{create("marketing"), create("support"), create("marketing")} {
+			assert.Equal(t, http.StatusOK, w.Code)
+		}
+		assert.JSONEq(t, `{"data": {"slug": "asd"}}`, create("support").Body.String())
+		m.AssertExpectations(t)
+	})
+}
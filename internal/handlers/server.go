@@ -4,27 +4,63 @@ import (
 	"context"
 	"errors"
 	"net/http"
+	"time"
 
 	"github.com/go-chi/chi"
 	"github.com/go-chi/render"
 
+	"url-shortener/internal/analytics"
+	"url-shortener/internal/auth"
 	"url-shortener/internal/chi_utils"
+	"url-shortener/internal/idempotency"
+	"url-shortener/internal/logger"
 	httplogger "url-shortener/internal/logger/http"
+	"url-shortener/internal/slugs"
+	"url-shortener/internal/storage"
+	"url-shortener/internal/urlpolicy"
 	"url-shortener/pkg/protocol"
 )
 
 var (
 	errIncorrectSlug = errors.New("The slug is incorrect")
+	errTimeout       = errors.New("The storage hasn't responded in time")
+	errInternal      = errors.New("The request cannot be processed")
 )
 
 type slugsRegistry interface {
-	RegisterURL(ctx context.Context, url string) (string, error)
-	GetURL(ctx context.Context, slug string) (string, error)
+	RegisterURL(ctx context.Context, link *slugs.Link) (string, error)
+	RegisterCustomURL(ctx context.Context, slug string, link *slugs.Link) error
+	RegisterURLs(ctx context.Context, links []*slugs.Link) ([]slugs.Registration, error)
+	RegisterUniqueURL(ctx context.Context, link *slugs.Link) (string, error)
+	GetLink(ctx context.Context, slug string) (*slugs.Link, error)
+	UpdateLink(ctx context.Context, slug string, update *slugs.LinkUpdate) (*slugs.Link, error)
+	DisableLink(ctx context.Context, slug string) error
+}
+
+type idempotencyKeeper interface {
+	Reserve(ctx context.Context, key string, fingerprint string) (string, error)
+	Complete(ctx context.Context, key string, fingerprint string, slug string) error
+	Release(ctx context.Context, key string, fingerprint string) error
+}
+
+type urlPolicy interface {
+	Check(ctx context.Context, url string, ownHost string) error
+}
+
+type hitsTracker interface {
+	TrackHit(ctx context.Context, slug string)
+	Stats(ctx context.Context, slug string) (*analytics.Counters, error)
 }
 
 type server struct {
 	slugMinLength int
+	redirectCode  int
+	batchLimit    int
+	batchMaxBytes int64
 	registry      slugsRegistry
+	tracker       hitsTracker
+	idempotency   idempotencyKeeper
+	urlPolicy     urlPolicy
 	bind          func(r *http.Request, v render.Binder) error
 }
 
@@ -35,18 +71,76 @@ func (s *server) CreateShortLink(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	slug, err := s.registry.RegisterURL(r.Context(), request.URL)
+	if err := s.checkURL(r, request.URL); err != nil {
+		render.Render(w, r, urlPolicyError(err))
+		return
+	}
+
+	if key := r.Header.Get(protocol.IdempotencyKeyHeader); key != "" {
+		s.createShortLinkOnce(w, r, key, &request)
+		return
+	}
+
+	slug, err := s.registerURL(r.Context(), &request)
 	if err != nil {
-		httplogger.FromRequest(r).Error().Err(err).Str("url", request.URL).Msg("Cannot generate a new slug")
-		render.Render(w, r, chi_utils.InternalServerError(err))
+		logRegistryError(r, err).Str("url", request.URL).Str("slug", request.Slug).Msg("Cannot register the url")
+		render.Render(w, r, registryError(err))
 		return
 	}
+	respondSlug(w, r, slug)
+}
 
+func respondSlug(w http.ResponseWriter, r *http.Request, slug string) {
 	response := protocol.CreateShortLinkResponse{}
 	response.Data.Slug = slug
 	render.Respond(w, r, &response)
 }
 
+func (s *server) registerURL(ctx context.Context, request *protocol.CreateShortLinkRequest) (string, error) {
+	link := newLink(ctx, request, time.Now())
+	if request.Dedupe {
+		return s.registry.RegisterUniqueURL(ctx, link)
+	}
+	if request.Slug == "" {
+		return s.registry.RegisterURL(ctx, link)
+	}
+	if err := s.registry.RegisterCustomURL(ctx, request.Slug, link); err != nil {
+		return "", err
+	}
+	return request.Slug, nil
+}
+
+//checkURL accepts every URL if there is no policy
+func (s *server) checkURL(r *http.Request, url string) error {
+	if s.urlPolicy == nil {
+		return nil
+	}
+	err := s.urlPolicy.Check(r.Context(), url, r.Host)
+	if err != nil {
+		httplogger.FromRequest(r).Debug().Err(err).Str("url", url).Msg("The url has been rejected")
+	}
+	return err
+}
+
+func urlPolicyError(err error) render.Renderer {
+	violation := &urlpolicy.Violation{}
+	if errors.As(err, &violation) {
+		return chi_utils.Rejected(err, violation.Reason)
+	}
+	return chi_utils.InvalidRequest(err)
+}
+
+//newLink records the API key which the link is created with
+func newLink(ctx context.Context, request *protocol.CreateShortLinkRequest, now time.Time) *slugs.Link {
+	return &slugs.Link{
+		URL:          request.URL,
+		ExpiresAt:    request.Expiration(now),
+		RedirectCode: request.RedirectCode,
+		Tags:         request.Tags,
+		Creator:      auth.KeyName(ctx),
+	}
+}
+
 func (s *server) OpenShortLink(w http.ResponseWriter, r *http.Request) {
 	slug := chi.URLParam(r, "slug")
 	if len(slug) < s.slugMinLength {
@@ -54,20 +148,229 @@ func (s *server) OpenShortLink(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	url, err := s.registry.GetURL(r.Context(), slug)
+	link, err := s.registry.GetLink(r.Context(), slug)
 	if err != nil {
-		httplogger.FromRequest(r).Error().Err(err).Str("slug", slug).Msg("Cannot get an url")
-		render.Render(w, r, chi_utils.InternalServerError(err))
+		logRegistryError(r, err).Str("slug", slug).Msg("Cannot get an url")
+		render.Render(w, r, registryError(err))
 		return
 	}
 
-	http.Redirect(w, r, url, http.StatusMovedPermanently)
+	if link.Disabled {
+		render.Render(w, r, chi_utils.Gone(slugs.ErrDisabled))
+		return
+	}
+
+	s.tracker.TrackHit(r.Context(), slug)
+	http.Redirect(w, r, link.URL, s.linkRedirectCode(link))
+}
+
+func (s *server) GetShortLinkStats(w http.ResponseWriter, r *http.Request) {
+	slug := chi.URLParam(r, "slug")
+	if len(slug) < s.slugMinLength {
+		render.Render(w, r, chi_utils.InvalidRequest(errIncorrectSlug))
+		return
+	}
+
+	if _, err := s.registry.GetLink(r.Context(), slug); err != nil {
+		logRegistryError(r, err).Str("slug", slug).Msg("Cannot get an url")
+		render.Render(w, r, registryError(err))
+		return
+	}
+
+	counters, err := s.tracker.Stats(r.Context(), slug)
+	if err != nil {
+		httplogger.FromRequest(r).Error().Err(err).Str("slug", slug).Msg("Cannot get the stats")
+		render.Render(w, r, registryError(err))
+		return
+	}
+
+	response := protocol.GetShortLinkStatsResponse{}
+	response.Data = *linkStats(counters)
+	render.Respond(w, r, &response)
+}
+
+func (s *server) GetShortLink(w http.ResponseWriter, r *http.Request) {
+	slug := chi.URLParam(r, "slug")
+	if len(slug) < s.slugMinLength {
+		render.Render(w, r, chi_utils.InvalidRequest(errIncorrectSlug))
+		return
+	}
+
+	link, err := s.registry.GetLink(r.Context(), slug)
+	if err != nil {
+		logRegistryError(r, err).Str("slug", slug).Msg("Cannot get a link")
+		render.Render(w, r, registryError(err))
+		return
+	}
+
+	counters, err := s.tracker.Stats(r.Context(), slug)
+	if err != nil {
+		httplogger.FromRequest(r).Error().Err(err).Str("slug", slug).Msg("Cannot get the stats")
+		render.Render(w, r, registryError(err))
+		return
+	}
+
+	response := protocol.GetShortLinkResponse{}
+	response.Data = s.shortLink(slug, link)
+	response.Data.Hits = linkStats(counters)
+	render.Respond(w, r, &response)
+}
+
+func (s *server) UpdateShortLink(w http.ResponseWriter, r *http.Request) {
+	slug := chi.URLParam(r, "slug")
+	if len(slug) < s.slugMinLength {
+		render.Render(w, r, chi_utils.InvalidRequest(errIncorrectSlug))
+		return
+	}
+
+	request := protocol.UpdateShortLinkRequest{}
+	if err := s.bind(r, &request); err != nil {
+		render.Render(w, r, chi_utils.InvalidRequest(err))
+		return
+	}
+	if request.URL != nil {
+		if err := s.checkURL(r, *request.URL); err != nil {
+			render.Render(w, r, urlPolicyError(err))
+			return
+		}
+	}
+
+	link, err := s.registry.UpdateLink(r.Context(), slug, &slugs.LinkUpdate{
+		URL:          request.URL,
+		RedirectCode: request.RedirectCode,
+	})
+	if err != nil {
+		logRegistryError(r, err).Str("slug", slug).Msg("Cannot update a link")
+		render.Render(w, r, registryError(err))
+		return
+	}
+
+	response := protocol.UpdateShortLinkResponse{}
+	response.Data = s.shortLink(slug, link)
+	render.Respond(w, r, &response)
+}
+
+func (s *server) DisableShortLink(w http.ResponseWriter, r *http.Request) {
+	slug := chi.URLParam(r, "slug")
+	if len(slug) < s.slugMinLength {
+		render.Render(w, r, chi_utils.InvalidRequest(errIncorrectSlug))
+		return
+	}
+
+	if err := s.registry.DisableLink(r.Context(), slug); err != nil {
+		logRegistryError(r, err).Str("slug", slug).Msg("Cannot disable a link")
+		render.Render(w, r, registryError(err))
+		return
+	}
+
+	render.NoContent(w, r)
+}
+
+func (s *server) shortLink(slug string, link *slugs.Link) protocol.ShortLink {
+	return protocol.ShortLink{
+		Slug:         slug,
+		URL:          link.URL,
+		CreatedAt:    optionalTime(link.CreatedAt),
+		UpdatedAt:    optionalTime(link.UpdatedAt),
+		ExpiresAt:    optionalTime(link.ExpiresAt),
+		RedirectCode: s.linkRedirectCode(link),
+		Tags:         link.Tags,
+		Creator:      link.Creator,
+		Disabled:     link.Disabled,
+	}
+}
+
+func (s *server) linkRedirectCode(link *slugs.Link) int {
+	if link.RedirectCode == 0 {
+		return s.redirectCode
+	}
+	return link.RedirectCode
+}
+
+func linkStats(counters *analytics.Counters) *protocol.ShortLinkStats {
+	return &protocol.ShortLinkStats{
+		Last24Hours: counters.Last24Hours,
+		LastWeek:    counters.LastWeek,
+		AllTime:     counters.AllTime,
+	}
+}
+
+//optionalTime turns the zero time into nil, so it's omitted in the responses
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+//registryError maps the errors of the registry onto the responses, the details of the storage failures aren't shown
+//to the clients, the unexpected errors are logged by logRegistryError instead
+func registryError(err error) render.Renderer {
+	switch {
+	case errors.Is(err, slugs.ErrNotFound):
+		return chi_utils.NotFound(slugs.ErrNotFound)
+	case errors.Is(err, slugs.ErrExpired):
+		return chi_utils.Gone(slugs.ErrExpired)
+	case errors.Is(err, slugs.ErrDisabled):
+		return chi_utils.Gone(slugs.ErrDisabled)
+	case errors.Is(err, slugs.ErrConflict):
+		return chi_utils.Conflict(slugs.ErrConflict)
+	case errors.Is(err, slugs.ErrSlugIsCorrupted):
+		return chi_utils.InvalidRequest(slugs.ErrSlugIsCorrupted)
+	case errors.Is(err, slugs.ErrInvalidExpiration):
+		return chi_utils.InvalidRequest(slugs.ErrInvalidExpiration)
+	case errors.Is(err, slugs.ErrInvalidCustomSlug):
+		return chi_utils.InvalidRequest(err)
+	case errors.Is(err, slugs.ErrSlugIsTaken):
+		return chi_utils.Conflict(err)
+	case errors.Is(err, idempotency.ErrKeyReused):
+		return chi_utils.UnprocessableEntity(idempotency.ErrKeyReused)
+	case errors.Is(err, idempotency.ErrInProgress):
+		return chi_utils.Conflict(idempotency.ErrInProgress)
+	case errors.Is(err, storage.ErrUnavailable):
+		return chi_utils.ServiceUnavailable(storage.ErrUnavailable)
+	case errors.Is(err, context.DeadlineExceeded):
+		return chi_utils.GatewayTimeout(errTimeout)
+	}
+	return chi_utils.InternalServerError(errInternal)
+}
+
+//clientErrors are reported at the debug level, so they don't flood the logs
+var clientErrors = []error{
+	slugs.ErrNotFound,
+	slugs.ErrExpired,
+	slugs.ErrDisabled,
+	slugs.ErrConflict,
+	slugs.ErrSlugIsCorrupted,
+	slugs.ErrInvalidCustomSlug,
+	slugs.ErrSlugIsTaken,
+	slugs.ErrInvalidExpiration,
+	idempotency.ErrKeyReused,
+	idempotency.ErrInProgress,
+	//the client has gone away
+	context.Canceled,
+}
+
+func logRegistryError(r *http.Request, err error) *logger.Event {
+	l := httplogger.FromRequest(r)
+	for _, e := range clientErrors {
+		if errors.Is(err, e) {
+			return l.Debug().Err(err)
+		}
+	}
+	return l.Error().Err(err)
 }
 
-func NewHandlers(slugMinLength int, registry slugsRegistry) *server {
+func NewHandlers(slugMinLength int, redirectCode int, batchLimit int, batchMaxBytes int64, registry slugsRegistry, tracker hitsTracker, idempotency idempotencyKeeper, urlPolicy urlPolicy) *server {
 	return &server{
 		slugMinLength: slugMinLength,
+		redirectCode:  redirectCode,
+		batchLimit:    batchLimit,
+		batchMaxBytes: batchMaxBytes,
 		registry:      registry,
+		tracker:       tracker,
+		idempotency:   idempotency,
+		urlPolicy:     urlPolicy,
 		bind:          render.Bind,
 	}
 }
@@ -3,10 +3,12 @@ package handlers
 import (
 	"context"
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/go-chi/chi"
 	"github.com/go-chi/render"
@@ -14,6 +16,11 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 
+	"url-shortener/internal/analytics"
+	"url-shortener/internal/auth"
+	"url-shortener/internal/slugs"
+	"url-shortener/internal/storage"
+	"url-shortener/internal/urlpolicy"
 	"url-shortener/pkg/protocol"
 )
 
@@ -21,16 +28,66 @@ type mockRegistry struct {
 	m *mock.Mock
 }
 
-func (r *mockRegistry) RegisterURL(ctx context.Context, url string) (string, error) {
-	args := r.m.Called(ctx, url)
+func (r *mockRegistry) RegisterURL(ctx context.Context, link *slugs.Link) (string, error) {
+	args := r.m.Called(ctx, link)
 	return args.String(0), args.Error(1)
 }
 
-func (r *mockRegistry) GetURL(ctx context.Context, slug string) (string, error) {
-	args := r.m.Called(ctx, slug)
+func (r *mockRegistry) RegisterCustomURL(ctx context.Context, slug string, link *slugs.Link) error {
+	args := r.m.Called(ctx, slug, link)
+	return args.Error(0)
+}
+
+func (r *mockRegistry) RegisterURLs(ctx context.Context, links []*slugs.Link) ([]slugs.Registration, error) {
+	args := r.m.Called(ctx, links)
+	registrations, _ := args.Get(0).([]slugs.Registration)
+	return registrations, args.Error(1)
+}
+
+func (r *mockRegistry) RegisterUniqueURL(ctx context.Context, link *slugs.Link) (string, error) {
+	args := r.m.Called(ctx, link)
 	return args.String(0), args.Error(1)
 }
 
+func (r *mockRegistry) GetLink(ctx context.Context, slug string) (*slugs.Link, error) {
+	args := r.m.Called(ctx, slug)
+	link, _ := args.Get(0).(*slugs.Link)
+	return link, args.Error(1)
+}
+
+func (r *mockRegistry) UpdateLink(ctx context.Context, slug string, update *slugs.LinkUpdate) (*slugs.Link, error) {
+	args := r.m.Called(ctx, slug, update)
+	link, _ := args.Get(0).(*slugs.Link)
+	return link, args.Error(1)
+}
+
+func (r *mockRegistry) DisableLink(ctx context.Context, slug string) error {
+	args := r.m.Called(ctx, slug)
+	return args.Error(0)
+}
+
+type mockTracker struct {
+	m *mock.Mock
+}
+
+func (t *mockTracker) TrackHit(ctx context.Context, slug string) {
+	t.m.Called(ctx, slug)
+}
+
+func (t *mockTracker) Stats(ctx context.Context, slug string) (*analytics.Counters, error) {
+	args := t.m.Called(ctx, slug)
+	counters, _ := args.Get(0).(*analytics.Counters)
+	return counters, args.Error(1)
+}
+
+type mockPolicy struct {
+	m *mock.Mock
+}
+
+func (p *mockPolicy) Check(ctx context.Context, url string, ownHost string) error {
+	return p.m.Called(ctx, url, ownHost).Error(0)
+}
+
 func TestCreateShortLink(t *testing.T) {
 	Convey("The handler works correctly", t, func() {
 		m := &mock.Mock{}
@@ -98,13 +155,166 @@ func TestCreateShortLink(t *testing.T) {
             [
                 {
                     "code": 500,
-                    "description": "Registry error"
+                    "description": "The request cannot be processed"
                 }
             ]
         }`,
 				string(body),
 			)
 		})
+		Convey("It reports the unavailable storage", func() {
+			srv := server{
+				registry: &mockRegistry{
+					m: m,
+				},
+				bind: func(r *http.Request, v render.Binder) error {
+					request := v.(*protocol.CreateShortLinkRequest)
+					request.URL = "http://url.me/something"
+					args := m.Called(r, v)
+					return args.Error(0)
+				},
+			}
+			m.
+				On("1", mock.Anything, mock.Anything).Return(nil).
+				On("RegisterURL", mock.Anything, mock.Anything).Return("", fmt.Errorf("%w: i/o timeout", storage.ErrUnavailable))
+
+			srv.CreateShortLink(w, req)
+
+			m.AssertExpectations(t)
+			assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+		})
+		Convey("It passes the expiration to the registry", func() {
+			expiresAt := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+			srv := server{
+				registry: &mockRegistry{
+					m: m,
+				},
+				bind: func(r *http.Request, v render.Binder) error {
+					request := v.(*protocol.CreateShortLinkRequest)
+					request.URL = "http://url.me/something"
+					request.ExpiresAt = &expiresAt
+					args := m.Called(r, v)
+					return args.Error(0)
+				},
+			}
+			m.
+				On("1", mock.Anything, mock.Anything).Return(nil).
+				On("RegisterURL", mock.Anything, &slugs.Link{URL: "http://url.me/something", ExpiresAt: expiresAt}).Return("", slugs.ErrInvalidExpiration)
+
+			srv.CreateShortLink(w, req)
+
+			m.AssertExpectations(t)
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+		})
+		Convey("It registers the custom slugs", func() {
+			srv := server{
+				registry: &mockRegistry{
+					m: m,
+				},
+				bind: func(r *http.Request, v render.Binder) error {
+					request := v.(*protocol.CreateShortLinkRequest)
+					request.URL = "http://url.me/something"
+					request.Slug = "my-link"
+					args := m.Called(r, v)
+					return args.Error(0)
+				},
+			}
+
+			Convey("It returns the custom slug", func() {
+				m.
+					On("1", mock.Anything, mock.Anything).Return(nil).
+					On("RegisterCustomURL", mock.Anything, "my-link", &slugs.Link{URL: "http://url.me/something"}).Return(nil)
+
+				srv.CreateShortLink(w, req)
+
+				m.AssertExpectations(t)
+				assert.Equal(t, http.StatusOK, w.Code)
+				resp := w.Result()
+				body, err := ioutil.ReadAll(resp.Body)
+				assert.NoError(t, err)
+				assert.JSONEq(t, `{"data": {"slug": "my-link"}}`, string(body))
+			})
+			Convey("It reports the taken slug", func() {
+				m.
+					On("1", mock.Anything, mock.Anything).Return(nil).
+					On("RegisterCustomURL", mock.Anything, "my-link", &slugs.Link{URL: "http://url.me/something"}).Return(slugs.ErrSlugIsTaken)
+
+				srv.CreateShortLink(w, req)
+
+				m.AssertExpectations(t)
+				assert.Equal(t, http.StatusConflict, w.Code)
+				resp := w.Result()
+				body, err := ioutil.ReadAll(resp.Body)
+				assert.NoError(t, err)
+				assert.JSONEq(t, `{"errors": [{"code": 409, "description": "The slug is already taken"}]}`, string(body))
+			})
+			Convey("It reports the invalid slug", func() {
+				m.
+					On("1", mock.Anything, mock.Anything).Return(nil).
+					On("RegisterCustomURL", mock.Anything, "my-link", &slugs.Link{URL: "http://url.me/something"}).Return(fmt.Errorf("%w: too long", slugs.ErrInvalidCustomSlug))
+
+				srv.CreateShortLink(w, req)
+
+				m.AssertExpectations(t)
+				assert.Equal(t, http.StatusBadRequest, w.Code)
+				resp := w.Result()
+				body, err := ioutil.ReadAll(resp.Body)
+				assert.NoError(t, err)
+				assert.JSONEq(t, `{"errors": [{"code": 400, "description": "The custom slug is invalid: too long"}]}`, string(body))
+			})
+		})
+		Convey("It deduplicates the links on request", func() {
+			srv := server{
+				registry: &mockRegistry{
+					m: m,
+				},
+				bind: func(r *http.Request, v render.Binder) error {
+					request := v.(*protocol.CreateShortLinkRequest)
+					request.URL = "http://url.me/something"
+					request.Dedupe = true
+					return nil
+				},
+			}
+			m.
+				On("RegisterUniqueURL", mock.Anything, &slugs.Link{URL: "http://url.me/something"}).Return("qwe", nil)
+
+			srv.CreateShortLink(w, req)
+
+			m.AssertExpectations(t)
+			assert.Equal(t, http.StatusOK, w.Code)
+			resp := w.Result()
+			body, err := ioutil.ReadAll(resp.Body)
+			assert.NoError(t, err)
+			assert.JSONEq(t, `{"data": {"slug": "qwe"}}`, string(body))
+		})
+
+		Convey("It rejects the URL which violates the policy", func() {
+			srv := server{
+				registry: &mockRegistry{
+					m: m,
+				},
+				urlPolicy: &mockPolicy{
+					m: m,
+				},
+				bind: func(r *http.Request, v render.Binder) error {
+					request := v.(*protocol.CreateShortLinkRequest)
+					request.URL = "http://localhost/admin"
+					return nil
+				},
+			}
+			m.
+				On("Check", mock.Anything, "http://localhost/admin", req.Host).Return(fmt.Errorf("%w: localhost", urlpolicy.ErrPrivateNetwork))
+
+			srv.CreateShortLink(w, req)
+
+			m.AssertExpectations(t)
+			assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+			resp := w.Result()
+			body, err := ioutil.ReadAll(resp.Body)
+			assert.NoError(t, err)
+			assert.JSONEq(t, `{"errors": [{"code": 422, "reason": "private_network", "description": "The URL leads to a private network: localhost"}]}`, string(body))
+		})
+
 		Convey("The handler returns a new slug", func() {
 			srv := server{
 				registry: &mockRegistry{
@@ -119,7 +329,7 @@ func TestCreateShortLink(t *testing.T) {
 			}
 			m.
 				On("1", mock.Anything, mock.Anything).Return(nil).
-				On("RegisterURL", mock.Anything, "http://url.me/something").Return("123", nil)
+				On("RegisterURL", mock.Anything, &slugs.Link{URL: "http://url.me/something"}).Return("123", nil)
 
 			srv.CreateShortLink(w, req)
 
@@ -139,6 +349,24 @@ func TestCreateShortLink(t *testing.T) {
 				string(body),
 			)
 		})
+		Convey("It records the API key of the creator", func() {
+			srv := server{
+				registry: &mockRegistry{
+					m: m,
+				},
+				bind: func(r *http.Request, v render.Binder) error {
+					v.(*protocol.CreateShortLinkRequest).URL = "http://url.me/something"
+					return nil
+				},
+			}
+			m.
+				On("RegisterURL", mock.Anything, &slugs.Link{URL: "http://url.me/something", Creator: "marketing"}).Return("123", nil)
+
+			srv.CreateShortLink(w, req.WithContext(auth.WithKey(req.Context(), &auth.Key{Name: "marketing"})))
+
+			m.AssertExpectations(t)
+			assert.Equal(t, http.StatusOK, w.Code)
+		})
 	})
 }
 
@@ -185,7 +413,7 @@ func TestOpenShortLink(t *testing.T) {
 				slugMinLength: 3,
 			}
 			m.
-				On("GetURL", mock.Anything, "123").Return("", errors.New("Registry error"))
+				On("GetLink", mock.Anything, "123").Return(nil, errors.New("Registry error"))
 
 			srv.OpenShortLink(w, req)
 
@@ -201,23 +429,108 @@ func TestOpenShortLink(t *testing.T) {
             [
                 {
                     "code": 500,
-                    "description": "Registry error"
+                    "description": "The request cannot be processed"
                 }
             ]
         }`,
 				string(body),
 			)
 		})
+		Convey("It maps the registry errors onto the status codes", func() {
+			cases := []struct {
+				err         error
+				code        int
+				description string
+			}{
+				{slugs.ErrNotFound, http.StatusNotFound, "The short link is not found"},
+				{slugs.ErrExpired, http.StatusGone, "The short link has expired"},
+				{slugs.ErrConflict, http.StatusConflict, "The short link is being changed concurrently"},
+				{fmt.Errorf("%w: oops", slugs.ErrSlugIsCorrupted), http.StatusBadRequest, "The slug is corrupted"},
+				{fmt.Errorf("%w: dial tcp", storage.ErrUnavailable), http.StatusServiceUnavailable, "The storage is unavailable"},
+				{fmt.Errorf("%w: i/o timeout", context.DeadlineExceeded), http.StatusGatewayTimeout, "The storage hasn't responded in time"},
+			}
+			for _, c := range cases {
+				m := &mock.Mock{}
+				srv := server{
+					registry: &mockRegistry{
+						m: m,
+					},
+					slugMinLength: 3,
+				}
+				m.
+					On("GetLink", mock.Anything, "123").Return(nil, c.err)
+				w := httptest.NewRecorder()
+
+				srv.OpenShortLink(w, req)
+
+				m.AssertExpectations(t)
+				assert.Equal(t, c.code, w.Code)
+				resp := w.Result()
+				body, err := ioutil.ReadAll(resp.Body)
+				assert.NoError(t, err)
+				assert.JSONEq(t,
+					fmt.Sprintf(`{"errors": [{"code": %d, "description": "%s"}]}`, c.code, c.description),
+					string(body),
+				)
+			}
+		})
+		Convey("It doesn't redirect from the disabled link", func() {
+			m := &mock.Mock{}
+			srv := server{
+				registry: &mockRegistry{
+					m: m,
+				},
+				tracker: &mockTracker{
+					m: m,
+				},
+				slugMinLength: 3,
+			}
+			m.
+				On("GetLink", mock.Anything, "123").Return(&slugs.Link{URL: "http://google.com/abc", Disabled: true}, nil)
+
+			srv.OpenShortLink(w, req)
+
+			m.AssertExpectations(t)
+			assert.Equal(t, http.StatusGone, w.Code)
+			assert.Empty(t, w.Header().Get("Location"))
+		})
+		Convey("It uses the redirect code of the link", func() {
+			m := &mock.Mock{}
+			srv := server{
+				registry: &mockRegistry{
+					m: m,
+				},
+				tracker: &mockTracker{
+					m: m,
+				},
+				slugMinLength: 3,
+				redirectCode:  http.StatusMovedPermanently,
+			}
+			m.
+				On("GetLink", mock.Anything, "123").Return(&slugs.Link{URL: "http://google.com/abc", RedirectCode: http.StatusTemporaryRedirect}, nil).
+				On("TrackHit", mock.Anything, "123").Return()
+
+			srv.OpenShortLink(w, req)
+
+			m.AssertExpectations(t)
+			assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+			assert.Equal(t, "http://google.com/abc", w.Header().Get("Location"))
+		})
 		Convey("It redirects to the related URL", func() {
 			m := &mock.Mock{}
 			srv := server{
 				registry: &mockRegistry{
 					m: m,
 				},
+				tracker: &mockTracker{
+					m: m,
+				},
 				slugMinLength: 3,
+				redirectCode:  http.StatusMovedPermanently,
 			}
 			m.
-				On("GetURL", mock.Anything, "123").Return("http://google.com/abc", nil)
+				On("GetLink", mock.Anything, "123").Return(&slugs.Link{URL: "http://google.com/abc"}, nil).
+				On("TrackHit", mock.Anything, "123").Return()
 
 			srv.OpenShortLink(w, req)
 
@@ -234,14 +547,351 @@ func TestOpenShortLink(t *testing.T) {
 	})
 }
 
+func TestGetShortLinkStats(t *testing.T) {
+	Convey("The handler works correctly", t, func() {
+		m := &mock.Mock{}
+		req := httptest.NewRequest(http.MethodGet, "http://blablabla.me", nil)
+		rctx := chi.NewRouteContext()
+		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+		rctx.URLParams.Add("slug", "123")
+		w := httptest.NewRecorder()
+		srv := server{
+			registry: &mockRegistry{
+				m: m,
+			},
+			tracker: &mockTracker{
+				m: m,
+			},
+			slugMinLength: 3,
+		}
+
+		Convey("It fails if the slug is too sort", func() {
+			srv.slugMinLength = 10
+
+			srv.GetShortLinkStats(w, req)
+
+			m.AssertExpectations(t)
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+		})
+		Convey("It handles the registry errors correctly", func() {
+			m.
+				On("GetLink", mock.Anything, "123").Return(nil, slugs.ErrNotFound)
+
+			srv.GetShortLinkStats(w, req)
+
+			m.AssertExpectations(t)
+			assert.Equal(t, http.StatusNotFound, w.Code)
+		})
+		Convey("It handles the tracker errors correctly", func() {
+			m.
+				On("GetLink", mock.Anything, "123").Return(&slugs.Link{URL: "http://google.com/abc"}, nil).
+				On("Stats", mock.Anything, "123").Return(nil, errors.New("Tracker error"))
+
+			srv.GetShortLinkStats(w, req)
+
+			m.AssertExpectations(t)
+			assert.Equal(t, http.StatusInternalServerError, w.Code)
+			resp := w.Result()
+			body, err := ioutil.ReadAll(resp.Body)
+			assert.NoError(t, err)
+			assert.JSONEq(t,
+				`
+        {
+            "errors":
+            [
+                {
+                    "code": 500,
+                    "description": "The request cannot be processed"
+                }
+            ]
+        }`,
+				string(body),
+			)
+		})
+		Convey("It returns the counters", func() {
+			m.
+				On("GetLink", mock.Anything, "123").Return(&slugs.Link{URL: "http://google.com/abc"}, nil).
+				On("Stats", mock.Anything, "123").Return(&analytics.Counters{Last24Hours: 3, LastWeek: 10, AllTime: 42}, nil)
+
+			srv.GetShortLinkStats(w, req)
+
+			m.AssertExpectations(t)
+			assert.Equal(t, http.StatusOK, w.Code)
+			resp := w.Result()
+			body, err := ioutil.ReadAll(resp.Body)
+			assert.NoError(t, err)
+			assert.JSONEq(t,
+				`
+        {
+            "data":
+            {
+                "last_24_hours": 3,
+                "last_week": 10,
+                "all_time": 42
+            }
+        }`,
+				string(body),
+			)
+		})
+	})
+}
+
+func TestGetShortLink(t *testing.T) {
+	Convey("The handler works correctly", t, func() {
+		m := &mock.Mock{}
+		req := httptest.NewRequest(http.MethodGet, "http://blablabla.me", nil)
+		rctx := chi.NewRouteContext()
+		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+		rctx.URLParams.Add("slug", "123")
+		w := httptest.NewRecorder()
+		srv := server{
+			registry: &mockRegistry{
+				m: m,
+			},
+			tracker: &mockTracker{
+				m: m,
+			},
+			slugMinLength: 3,
+			redirectCode:  http.StatusMovedPermanently,
+		}
+
+		Convey("It fails if the slug is too sort", func() {
+			srv.slugMinLength = 10
+
+			srv.GetShortLink(w, req)
+
+			m.AssertExpectations(t)
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+		})
+		Convey("It handles the registry errors correctly", func() {
+			m.
+				On("GetLink", mock.Anything, "123").Return(nil, slugs.ErrExpired)
+
+			srv.GetShortLink(w, req)
+
+			m.AssertExpectations(t)
+			assert.Equal(t, http.StatusGone, w.Code)
+		})
+		Convey("It handles the tracker errors correctly", func() {
+			m.
+				On("GetLink", mock.Anything, "123").Return(&slugs.Link{URL: "http://google.com/abc"}, nil).
+				On("Stats", mock.Anything, "123").Return(nil, errors.New("Tracker error"))
+
+			srv.GetShortLink(w, req)
+
+			m.AssertExpectations(t)
+			assert.Equal(t, http.StatusInternalServerError, w.Code)
+		})
+		Convey("It returns the legacy link", func() {
+			m.
+				On("GetLink", mock.Anything, "123").Return(&slugs.Link{URL: "http://google.com/abc"}, nil).
+				On("Stats", mock.Anything, "123").Return(&analytics.Counters{}, nil)
+
+			srv.GetShortLink(w, req)
+
+			m.AssertExpectations(t)
+			assert.Equal(t, http.StatusOK, w.Code)
+			resp := w.Result()
+			body, err := ioutil.ReadAll(resp.Body)
+			assert.NoError(t, err)
+			assert.JSONEq(t,
+				`
+        {
+            "data":
+            {
+                "slug": "123",
+                "url": "http://google.com/abc",
+                "redirect_code": 301,
+                "hits": {"last_24_hours": 0, "last_week": 0, "all_time": 0}
+            }
+        }`,
+				string(body),
+			)
+		})
+		Convey("It returns the link", func() {
+			link := &slugs.Link{
+				URL:          "http://google.com/abc",
+				CreatedAt:    time.Date(2020, 3, 15, 10, 30, 0, 0, time.UTC),
+				ExpiresAt:    time.Date(2020, 4, 15, 10, 30, 0, 0, time.UTC),
+				RedirectCode: http.StatusFound,
+				Tags:         []string{"search"},
+				Creator:      "marketing",
+			}
+			m.
+				On("GetLink", mock.Anything, "123").Return(link, nil).
+				On("Stats", mock.Anything, "123").Return(&analytics.Counters{Last24Hours: 3, LastWeek: 10, AllTime: 42}, nil)
+
+			srv.GetShortLink(w, req)
+
+			m.AssertExpectations(t)
+			assert.Equal(t, http.StatusOK, w.Code)
+			resp := w.Result()
+			body, err := ioutil.ReadAll(resp.Body)
+			assert.NoError(t, err)
+			assert.JSONEq(t,
+				`
+        {
+            "data":
+            {
+                "slug": "123",
+                "url": "http://google.com/abc",
+                "created_at": "2020-03-15T10:30:00Z",
+                "expires_at": "2020-04-15T10:30:00Z",
+                "redirect_code": 302,
+                "tags": ["search"],
+                "creator": "marketing",
+                "hits": {"last_24_hours": 3, "last_week": 10, "all_time": 42}
+            }
+        }`,
+				string(body),
+			)
+		})
+	})
+}
+
+func TestUpdateShortLink(t *testing.T) {
+	Convey("The handler works correctly", t, func() {
+		m := &mock.Mock{}
+		req := httptest.NewRequest(http.MethodPatch, "http://blablabla.me", nil)
+		rctx := chi.NewRouteContext()
+		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+		rctx.URLParams.Add("slug", "123")
+		w := httptest.NewRecorder()
+		url := "http://google.com/xyz"
+		srv := server{
+			registry: &mockRegistry{
+				m: m,
+			},
+			slugMinLength: 3,
+			redirectCode:  http.StatusMovedPermanently,
+			bind: func(r *http.Request, v render.Binder) error {
+				v.(*protocol.UpdateShortLinkRequest).URL = &url
+				return nil
+			},
+		}
+
+		Convey("It fails if the slug is too sort", func() {
+			srv.slugMinLength = 10
+
+			srv.UpdateShortLink(w, req)
+
+			m.AssertExpectations(t)
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+		})
+		Convey("It handles the request binding errors correctly", func() {
+			srv.bind = func(r *http.Request, v render.Binder) error {
+				return errors.New("Binding error")
+			}
+
+			srv.UpdateShortLink(w, req)
+
+			m.AssertExpectations(t)
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+		})
+		Convey("It handles the registry errors correctly", func() {
+			m.
+				On("UpdateLink", mock.Anything, "123", &slugs.LinkUpdate{URL: &url}).Return(nil, slugs.ErrDisabled)
+
+			srv.UpdateShortLink(w, req)
+
+			m.AssertExpectations(t)
+			assert.Equal(t, http.StatusGone, w.Code)
+		})
+		Convey("It returns the updated link", func() {
+			link := &slugs.Link{
+				URL:       url,
+				CreatedAt: time.Date(2020, 3, 15, 10, 30, 0, 0, time.UTC),
+				UpdatedAt: time.Date(2020, 3, 16, 10, 30, 0, 0, time.UTC),
+			}
+			m.
+				On("UpdateLink", mock.Anything, "123", &slugs.LinkUpdate{URL: &url}).Return(link, nil)
+
+			srv.UpdateShortLink(w, req)
+
+			m.AssertExpectations(t)
+			assert.Equal(t, http.StatusOK, w.Code)
+			resp := w.Result()
+			body, err := ioutil.ReadAll(resp.Body)
+			assert.NoError(t, err)
+			assert.JSONEq(t,
+				`
+        {
+            "data":
+            {
+                "slug": "123",
+                "url": "http://google.com/xyz",
+                "created_at": "2020-03-15T10:30:00Z",
+                "updated_at": "2020-03-16T10:30:00Z",
+                "redirect_code": 301
+            }
+        }`,
+				string(body),
+			)
+		})
+	})
+}
+
+func TestDisableShortLink(t *testing.T) {
+	Convey("The handler works correctly", t, func() {
+		m := &mock.Mock{}
+		req := httptest.NewRequest(http.MethodDelete, "http://blablabla.me", nil)
+		rctx := chi.NewRouteContext()
+		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+		rctx.URLParams.Add("slug", "123")
+		w := httptest.NewRecorder()
+		srv := server{
+			registry: &mockRegistry{
+				m: m,
+			},
+			slugMinLength: 3,
+		}
+
+		Convey("It fails if the slug is too sort", func() {
+			srv.slugMinLength = 10
+
+			srv.DisableShortLink(w, req)
+
+			m.AssertExpectations(t)
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+		})
+		Convey("It handles the registry errors correctly", func() {
+			m.
+				On("DisableLink", mock.Anything, "123").Return(slugs.ErrNotFound)
+
+			srv.DisableShortLink(w, req)
+
+			m.AssertExpectations(t)
+			assert.Equal(t, http.StatusNotFound, w.Code)
+		})
+		Convey("It disables the link", func() {
+			m.
+				On("DisableLink", mock.Anything, "123").Return(nil)
+
+			srv.DisableShortLink(w, req)
+
+			m.AssertExpectations(t)
+			assert.Equal(t, http.StatusNoContent, w.Code)
+		})
+	})
+}
+
 func TestNewHandlers(t *testing.T) {
 	r := &mockRegistry{}
-	srv := NewHandlers(73, r)
+	tr := &mockTracker{}
+	k := &mockKeeper{}
+	p := &mockPolicy{}
+	srv := NewHandlers(73, http.StatusFound, 100, 1024, r, tr, k, p)
 	srv.bind = nil
 	assert.Equal(t,
 		&server{
 			slugMinLength: 73,
+			redirectCode:  http.StatusFound,
+			batchLimit:    100,
+			batchMaxBytes: 1024,
 			registry:      r,
+			tracker:       tr,
+			idempotency:   k,
+			urlPolicy:     p,
 		},
 		srv,
 	)
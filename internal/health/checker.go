@@ -0,0 +1,91 @@
+package health
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-chi/render"
+
+	httplogger "url-shortener/internal/logger/http"
+	"url-shortener/pkg/protocol"
+)
+
+//Check reports whether the dependency can be used
+type Check func(ctx context.Context) error
+
+//checker answers the probes of the load balancers and the orchestrators
+type checker struct {
+	timeout      time.Duration
+	names        []string
+	checks       []Check
+	shuttingDown int32
+}
+
+//Add registers the dependency which has to be available for the service to be ready
+func (c *checker) Add(name string, check Check) {
+	c.names = append(c.names, name)
+	c.checks = append(c.checks, check)
+}
+
+//Shutdown makes the service not ready, so the load balancers stop sending the requests to it
+func (c *checker) Shutdown() {
+	atomic.StoreInt32(&c.shuttingDown, 1)
+}
+
+//Liveness reports that the process is able to handle the requests at all
+func (c *checker) Liveness(w http.ResponseWriter, r *http.Request) {
+	render.JSON(w, r, &protocol.HealthResponse{Status: protocol.HealthStatusOK})
+}
+
+//Readiness checks all the dependencies at once and reports the status of each of them
+func (c *checker) Readiness(w http.ResponseWriter, r *http.Request) {
+	if atomic.LoadInt32(&c.shuttingDown) == 1 {
+		render.Status(r, http.StatusServiceUnavailable)
+		render.JSON(w, r, &protocol.HealthResponse{Status: protocol.HealthStatusShuttingDown})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), c.timeout)
+	defer cancel()
+
+	errs := make([]error, len(c.checks))
+	wg := sync.WaitGroup{}
+	for i, check := range c.checks {
+		wg.Add(1)
+		go func(i int, check Check) {
+			defer wg.Done()
+			errs[i] = check(ctx)
+		}(i, check)
+	}
+	wg.Wait()
+
+	response := protocol.HealthResponse{
+		Status:       protocol.HealthStatusOK,
+		Dependencies: make(map[string]protocol.DependencyHealth, len(c.checks)),
+	}
+	for i, err := range errs {
+		if err == nil {
+			response.Dependencies[c.names[i]] = protocol.DependencyHealth{Status: protocol.HealthStatusOK}
+			continue
+		}
+		httplogger.FromRequest(r).Warn().Err(err).Str("dependency", c.names[i]).Msg("The dependency is unavailable")
+		response.Status = protocol.HealthStatusFailed
+		response.Dependencies[c.names[i]] = protocol.DependencyHealth{
+			Status: protocol.HealthStatusFailed,
+			Error:  err.Error(),
+		}
+	}
+	if response.Status != protocol.HealthStatusOK {
+		render.Status(r, http.StatusServiceUnavailable)
+	}
+	render.JSON(w, r, &response)
+}
+
+func NewChecker(cfg *Config) *checker {
+	return &checker{
+		timeout: cfg.Timeout,
+	}
+}
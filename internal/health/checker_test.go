@@ -0,0 +1,77 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChecker(t *testing.T) {
+	Convey("Test the probes", t, func() {
+		c := NewChecker(&Config{Timeout: 50 * time.Millisecond})
+		c.Add("storage", func(ctx context.Context) error {
+			return nil
+		})
+		probe := func(handler http.HandlerFunc) (int, string) {
+			w := httptest.NewRecorder()
+			handler(w, httptest.NewRequest(http.MethodGet, "http://blablabla.me/internal/readyz", nil))
+			body, err := ioutil.ReadAll(w.Result().Body)
+			assert.NoError(t, err)
+			return w.Code, string(body)
+		}
+
+		Convey("It is alive until the end", func() {
+			c.Shutdown()
+
+			code, body := probe(c.Liveness)
+			assert.Equal(t, http.StatusOK, code)
+			assert.JSONEq(t, `{"status": "ok"}`, body)
+		})
+
+		Convey("It is ready if all the dependencies are available", func() {
+			code, body := probe(c.Readiness)
+			assert.Equal(t, http.StatusOK, code)
+			assert.JSONEq(t, `{"status": "ok", "dependencies": {"storage": {"status": "ok"}}}`, body)
+		})
+
+		Convey("It reports the unavailable dependencies", func() {
+			c.Add("tracer", func(ctx context.Context) error {
+				return errors.New("no such host")
+			})
+			c.Add("slow", func(ctx context.Context) error {
+				<-ctx.Done()
+				return ctx.Err()
+			})
+
+			code, body := probe(c.Readiness)
+			assert.Equal(t, http.StatusServiceUnavailable, code)
+			assert.JSONEq(t,
+				`
+            {
+                "status": "failed",
+                "dependencies": {
+                    "storage": {"status": "ok"},
+                    "tracer": {"status": "failed", "error": "no such host"},
+                    "slow": {"status": "failed", "error": "context deadline exceeded"}
+                }
+            }`,
+				body,
+			)
+		})
+
+		Convey("It isn't ready after the shutdown has begun", func() {
+			c.Shutdown()
+
+			code, body := probe(c.Readiness)
+			assert.Equal(t, http.StatusServiceUnavailable, code)
+			assert.JSONEq(t, `{"status": "shutting_down"}`, body)
+		})
+	})
+}
@@ -0,0 +1,8 @@
+package health
+
+import "time"
+
+type Config struct {
+	//Timeout limits every check of the dependencies
+	Timeout time.Duration `env:"HEALTH_TIMEOUT,default=1s"`
+}
@@ -0,0 +1,9 @@
+package idempotency
+
+import "time"
+
+type Config struct {
+	Window time.Duration `env:"IDEMPOTENCY_WINDOW,default=24h"`
+	//PendingTimeout is how long the key stays reserved by the request, it has to outlast the creation of a link
+	PendingTimeout time.Duration `env:"IDEMPOTENCY_PENDINGTIMEOUT,default=30s"`
+}
@@ -0,0 +1,156 @@
+package idempotency
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"url-shortener/internal/auth"
+	"url-shortener/internal/logger"
+	"url-shortener/internal/storage"
+)
+
+var (
+	ErrKeyReused   = errors.New("The idempotency key has been used for another request")
+	ErrInvalidKey  = errors.New("The idempotency key is invalid")
+	ErrInProgress  = errors.New("The request with the idempotency key is still in progress")
+	ErrKeyReleased = errors.New("The idempotency key has been released before the request has been completed")
+)
+
+//The keys are chosen by the clients, so their length is limited to keep the storage keys reasonable
+const maxKeyLength = 255
+
+const (
+	//statePending marks the key reserved by the request which is being processed
+	statePending = "pending"
+	//stateFailed marks the key of the failed request, it may be reserved again by a retry
+	stateFailed = "failed"
+)
+
+//record keeps the fingerprint of the request together with the slug it has been answered with, the state is
+//empty for the completed requests
+type record struct {
+	Fingerprint string `json:"fingerprint"`
+	Slug        string `json:"slug,omitempty"`
+	State       string `json:"state,omitempty"`
+}
+
+type keeper struct {
+	storage        storage.Storage
+	window         time.Duration
+	pendingTimeout time.Duration
+}
+
+//ValidateKey reports whether the key may be used to identify a request
+func ValidateKey(key string) error {
+	if len(key) > maxKeyLength {
+		return fmt.Errorf("%w: it mustn't be longer than %d characters", ErrInvalidKey, maxKeyLength)
+	}
+	return nil
+}
+
+//Reserve takes the key for the request before the link is created, so only one of the concurrent replays creates
+//it. The empty slug means that the key has been reserved and the request has to be completed or released. The slug
+//of the completed request is returned to its replays. It fails with ErrInProgress if a replay is being processed
+//and with ErrKeyReused if the key has been used for a request with another fingerprint.
+func (k *keeper) Reserve(ctx context.Context, key string, fingerprint string) (string, error) {
+	pending, err := encodeRecord(record{Fingerprint: fingerprint, State: statePending})
+	if err != nil {
+		return "", err
+	}
+
+	err = k.storage.CreateValue(ctx, storageKey(ctx, key), pending, k.pendingTimeout)
+	if err == nil {
+		return "", nil
+	}
+	if !errors.Is(err, storage.ErrAlreadyExists) {
+		return "", err
+	}
+
+	value, err := k.storage.LoadValue(ctx, storageKey(ctx, key))
+	if errors.Is(err, storage.ErrNotFound) {
+		// The reservation has just expired, so the replay may be still running
+		return "", ErrInProgress
+	}
+	if err != nil {
+		return "", err
+	}
+	r := record{}
+	if err := json.Unmarshal([]byte(value), &r); err != nil {
+		return "", err
+	}
+	if r.Fingerprint != fingerprint {
+		return "", ErrKeyReused
+	}
+
+	switch r.State {
+	case statePending:
+		return "", ErrInProgress
+	case stateFailed:
+		err := k.storage.UpdateValue(ctx, storageKey(ctx, key), value, pending, k.pendingTimeout)
+		if errors.Is(err, storage.ErrValueChanged) || errors.Is(err, storage.ErrNotFound) {
+			logger.Ctx(ctx).Debug().Str("key", key).Msg("The failed request has been retried concurrently")
+			return "", ErrInProgress
+		}
+		if err != nil {
+			return "", err
+		}
+		return "", nil
+	}
+	return r.Slug, nil
+}
+
+//Complete keeps the slug of the reserved request for the window. It fails with ErrKeyReleased if the reservation
+//has expired before.
+func (k *keeper) Complete(ctx context.Context, key string, fingerprint string, slug string) error {
+	return k.replace(ctx, key, fingerprint, record{Fingerprint: fingerprint, Slug: slug}, k.window)
+}
+
+//Release lets the retries of the failed request reserve the key again
+func (k *keeper) Release(ctx context.Context, key string, fingerprint string) error {
+	return k.replace(ctx, key, fingerprint, record{Fingerprint: fingerprint, State: stateFailed}, k.pendingTimeout)
+}
+
+func (k *keeper) replace(ctx context.Context, key string, fingerprint string, r record, expiration time.Duration) error {
+	pending, err := encodeRecord(record{Fingerprint: fingerprint, State: statePending})
+	if err != nil {
+		return err
+	}
+	value, err := encodeRecord(r)
+	if err != nil {
+		return err
+	}
+
+	err = k.storage.UpdateValue(ctx, storageKey(ctx, key), pending, value, expiration)
+	if errors.Is(err, storage.ErrValueChanged) || errors.Is(err, storage.ErrNotFound) {
+		return ErrKeyReleased
+	}
+	return err
+}
+
+func encodeRecord(r record) (string, error) {
+	value, err := json.Marshal(r)
+	if err != nil {
+		return "", err
+	}
+	return string(value), nil
+}
+
+//storageKey scopes the key by the API key, so the clients cannot block or probe the keys of each other. The keys
+//of the anonymous requests keep the unscoped form.
+func storageKey(ctx context.Context, key string) string {
+	if creator := auth.KeyName(ctx); creator != "" {
+		return "idempotency:{" + creator + "}:" + key
+	}
+	return "idempotency:" + key
+}
+
+func NewKeeper(cfg *Config, storage storage.Storage) *keeper {
+	return &keeper{
+		storage:        storage,
+		window:         cfg.Window,
+		pendingTimeout: cfg.PendingTimeout,
+	}
+}
@@ -0,0 +1,204 @@
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"url-shortener/internal/auth"
+	"url-shortener/internal/storage"
+	"url-shortener/internal/storage/memory"
+)
+
+type mockStorage struct {
+	storage.Storage
+	m *mock.Mock
+}
+
+func (s *mockStorage) CreateValue(ctx context.Context, key string, value string, expiration time.Duration) error {
+	args := s.m.Called(ctx, key, value, expiration)
+	return args.Error(0)
+}
+
+func (s *mockStorage) UpdateValue(ctx context.Context, key string, previous string, value string, expiration time.Duration) error {
+	args := s.m.Called(ctx, key, previous, value, expiration)
+	return args.Error(0)
+}
+
+func (s *mockStorage) LoadValue(ctx context.Context, key string) (string, error) {
+	args := s.m.Called(ctx, key)
+	return args.String(0), args.Error(1)
+}
+
+const (
+	testRecord        = `{"fingerprint":"abc","slug":"qwe"}`
+	testPendingRecord = `{"fingerprint":"abc","state":"pending"}`
+	testFailedRecord  = `{"fingerprint":"abc","state":"failed"}`
+)
+
+func TestValidateKey(t *testing.T) {
+	assert.NoError(t, ValidateKey("retry-42"))
+	assert.True(t, errors.Is(ValidateKey(strings.Repeat("x", 256)), ErrInvalidKey))
+}
+
+func TestKeeper(t *testing.T) {
+	Convey("Test keeper", t, func() {
+		m := &mock.Mock{}
+		k := NewKeeper(&Config{Window: time.Hour, PendingTimeout: time.Minute}, &mockStorage{m: m})
+
+		Convey("It reserves the unknown key", func() {
+			m.
+				On("CreateValue", mock.Anything, "idempotency:retry-42", testPendingRecord, time.Minute).Return(nil)
+
+			slug, err := k.Reserve(context.TODO(), "retry-42", "abc")
+
+			m.AssertExpectations(t)
+			assert.NoError(t, err)
+			assert.Empty(t, slug)
+		})
+
+		Convey("It scopes the key by the API key", func() {
+			ctx := auth.WithKey(context.TODO(), &auth.Key{Name: "marketing"})
+			m.
+				On("CreateValue", mock.Anything, "idempotency:{marketing}:retry-42", testPendingRecord, time.Minute).Return(nil)
+
+			slug, err := k.Reserve(ctx, "retry-42", "abc")
+
+			m.AssertExpectations(t)
+			assert.NoError(t, err)
+			assert.Empty(t, slug)
+		})
+		Convey("It fails if the key cannot be reserved", func() {
+			m.
+				On("CreateValue", mock.Anything, "idempotency:retry-42", testPendingRecord, time.Minute).Return(errors.New("CreateValue error"))
+
+			_, err := k.Reserve(context.TODO(), "retry-42", "abc")
+
+			m.AssertExpectations(t)
+			assert.EqualError(t, err, "CreateValue error")
+		})
+
+		Convey("It returns the slug of the completed request", func() {
+			m.
+				On("CreateValue", mock.Anything, "idempotency:retry-42", testPendingRecord, time.Minute).Return(storage.ErrAlreadyExists).
+				On("LoadValue", mock.Anything, "idempotency:retry-42").Return(testRecord, nil)
+
+			slug, err := k.Reserve(context.TODO(), "retry-42", "abc")
+
+			m.AssertExpectations(t)
+			assert.NoError(t, err)
+			assert.Equal(t, "qwe", slug)
+		})
+
+		Convey("It rejects another request", func() {
+			m.
+				On("CreateValue", mock.Anything, "idempotency:retry-42", `{"fingerprint":"xyz","state":"pending"}`, time.Minute).Return(storage.ErrAlreadyExists).
+				On("LoadValue", mock.Anything, "idempotency:retry-42").Return(testPendingRecord, nil)
+
+			_, err := k.Reserve(context.TODO(), "retry-42", "xyz")
+
+			m.AssertExpectations(t)
+			assert.Equal(t, ErrKeyReused, err)
+		})
+
+		Convey("It reports the replay in progress", func() {
+			m.
+				On("CreateValue", mock.Anything, "idempotency:retry-42", testPendingRecord, time.Minute).Return(storage.ErrAlreadyExists).
+				On("LoadValue", mock.Anything, "idempotency:retry-42").Return(testPendingRecord, nil)
+
+			_, err := k.Reserve(context.TODO(), "retry-42", "abc")
+
+			m.AssertExpectations(t)
+			assert.Equal(t, ErrInProgress, err)
+		})
+
+		Convey("It reserves the key of the failed request again", func() {
+			m.
+				On("CreateValue", mock.Anything, "idempotency:retry-42", testPendingRecord, time.Minute).Return(storage.ErrAlreadyExists).
+				On("LoadValue", mock.Anything, "idempotency:retry-42").Return(testFailedRecord, nil).
+				On("UpdateValue", mock.Anything, "idempotency:retry-42", testFailedRecord, testPendingRecord, time.Minute).Return(nil)
+
+			slug, err := k.Reserve(context.TODO(), "retry-42", "abc")
+
+			m.AssertExpectations(t)
+			assert.NoError(t, err)
+			assert.Empty(t, slug)
+		})
+
+		Convey("It lets only one retry of the failed request reserve the key", func() {
+			m.
+				On("CreateValue", mock.Anything, "idempotency:retry-42", testPendingRecord, time.Minute).Return(storage.ErrAlreadyExists).
+				On("LoadValue", mock.Anything, "idempotency:retry-42").Return(testFailedRecord, nil).
+				On("UpdateValue", mock.Anything, "idempotency:retry-42", testFailedRecord, testPendingRecord, time.Minute).Return(storage.ErrValueChanged)
+
+			_, err := k.Reserve(context.TODO(), "retry-42", "abc")
+
+			m.AssertExpectations(t)
+			assert.Equal(t, ErrInProgress, err)
+		})
+
+		Convey("It saves the slug for the window", func() {
+			m.
+				On("UpdateValue", mock.Anything, "idempotency:retry-42", testPendingRecord, testRecord, time.Hour).Return(nil)
+
+			err := k.Complete(context.TODO(), "retry-42", "abc", "qwe")
+
+			m.AssertExpectations(t)
+			assert.NoError(t, err)
+		})
+
+		Convey("It reports the expired reservation", func() {
+			m.
+				On("UpdateValue", mock.Anything, "idempotency:retry-42", testPendingRecord, testRecord, time.Hour).Return(storage.ErrNotFound)
+
+			err := k.Complete(context.TODO(), "retry-42", "abc", "qwe")
+
+			m.AssertExpectations(t)
+			assert.Equal(t, ErrKeyReleased, err)
+		})
+
+		Convey("It releases the key of the failed request", func() {
+			m.
+				On("UpdateValue", mock.Anything, "idempotency:retry-42", testPendingRecord, testFailedRecord, time.Minute).Return(nil)
+
+			err := k.Release(context.TODO(), "retry-42", "abc")
+
+			m.AssertExpectations(t)
+			assert.NoError(t, err)
+		})
+	})
+}
+
+func TestKeeperConcurrency(t *testing.T) {
+	k := NewKeeper(&Config{Window: time.Hour, PendingTimeout: time.Minute}, memory.NewStorage())
+
+	const replays = 10
+	errs := make(chan error, replays)
+	for i := 0; i < replays; i++ {
+		go func() {
+			_, err := k.Reserve(context.TODO(), "retry-42", "abc")
+			errs <- err
+		}()
+	}
+	reserved := 0
+	for i := 0; i < replays; i++ {
+		err := <-errs
+		if err == nil {
+			reserved++
+			continue
+		}
+		assert.Equal(t, ErrInProgress, err)
+	}
+	assert.Equal(t, 1, reserved)
+
+	assert.NoError(t, k.Complete(context.TODO(), "retry-42", "abc", "qwe"))
+	slug, err := k.Reserve(context.TODO(), "retry-42", "abc")
+	assert.NoError(t, err)
+	assert.Equal(t, "qwe", slug)
+}
@@ -0,0 +1,12 @@
+package jaeger
+
+import (
+	"context"
+	"net"
+)
+
+//Ping resolves the address of the agent, the spans are sent over UDP, so the agent itself cannot be reached
+func Ping(ctx context.Context, cfg *Config) error {
+	_, err := net.DefaultResolver.LookupHost(ctx, cfg.Agent.Host)
+	return err
+}
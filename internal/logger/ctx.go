@@ -7,6 +7,7 @@ import (
 )
 
 type Logger = zerolog.Logger
+type Event = zerolog.Event
 
 func Ctx(ctx context.Context) *Logger {
 	return zerolog.Ctx(ctx)
@@ -0,0 +1,74 @@
+package net_utils
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+//ParseNetworks accepts both the CIDRs and the single IPs
+func ParseNetworks(addresses []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(addresses))
+	for _, address := range addresses {
+		if !strings.Contains(address, "/") {
+			ip := net.ParseIP(address)
+			if ip == nil {
+				return nil, fmt.Errorf("The address %q is invalid", address)
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(len(ip)*8, len(ip)*8)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(address)
+		if err != nil {
+			return nil, fmt.Errorf("The network %q is invalid: %w", address, err)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+//Contains reports whether the IP belongs to any of the networks
+func Contains(networks []*net.IPNet, ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+//RemoteIP returns the IP of the peer, the forwarded addresses aren't taken into account
+func RemoteIP(remoteAddr string) net.IP {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	return net.ParseIP(host)
+}
+
+//ClientIP returns the first IP of the chain of the proxies which isn't trusted. The proxies append the addresses of
+//their peers to X-Forwarded-For, so it's read from the end and the addresses before the first untrusted one
+//might have been forged by the client.
+func ClientIP(remoteAddr string, forwardedFor []string, trusted []*net.IPNet) net.IP {
+	ip := RemoteIP(remoteAddr)
+	if !Contains(trusted, ip) {
+		return ip
+	}
+	for i := len(forwardedFor) - 1; i >= 0; i-- {
+		addresses := strings.Split(forwardedFor[i], ",")
+		for j := len(addresses) - 1; j >= 0; j-- {
+			forwarded := net.ParseIP(strings.TrimSpace(addresses[j]))
+			if forwarded == nil {
+				return ip
+			}
+			ip = forwarded
+			if !Contains(trusted, ip) {
+				return ip
+			}
+		}
+	}
+	return ip
+}
@@ -0,0 +1,41 @@
+package net_utils
+
+import (
+	"net"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientIP(t *testing.T) {
+	Convey("The client IP is found behind the trusted proxies only", t, func() {
+		trusted, err := ParseNetworks([]string{"10.0.0.0/8", "192.168.1.1"})
+		assert.NoError(t, err)
+
+		cases := []struct {
+			remoteAddr   string
+			forwardedFor []string
+			expected     string
+		}{
+			{"1.2.3.4:5678", nil, "1.2.3.4"},
+			{"1.2.3.4:5678", []string{"5.6.7.8"}, "1.2.3.4"},
+			{"10.0.0.1:5678", nil, "10.0.0.1"},
+			{"10.0.0.1:5678", []string{"5.6.7.8"}, "5.6.7.8"},
+			{"10.0.0.1:5678", []string{"9.9.9.9, 5.6.7.8, 192.168.1.1"}, "5.6.7.8"},
+			{"10.0.0.1:5678", []string{"9.9.9.9", "5.6.7.8, 10.1.1.1"}, "5.6.7.8"},
+			{"10.0.0.1:5678", []string{"forged, 10.1.1.1"}, "10.1.1.1"},
+			{"[::1]:5678", []string{"5.6.7.8"}, "::1"},
+		}
+		for _, c := range cases {
+			assert.Equal(t, net.ParseIP(c.expected), ClientIP(c.remoteAddr, c.forwardedFor, trusted), c)
+		}
+	})
+
+	Convey("The invalid networks are rejected", t, func() {
+		for _, address := range []string{"10.0.0.0/33", "localhost", ""} {
+			_, err := ParseNetworks([]string{address})
+			assert.Error(t, err, address)
+		}
+	})
+}
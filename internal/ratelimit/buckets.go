@@ -0,0 +1,69 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+//Buckets keeps the token buckets of the clients. TakeToken refills the bucket for the time passed since it was
+//used last, takes a token if there is one and returns the tokens left.
+type Buckets interface {
+	TakeToken(ctx context.Context, key string, rate float64, burst int, now time.Time) (allowed bool, tokens float64, err error)
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+//localBuckets keeps the buckets in the memory of the instance, so every instance allows the rate on its own
+type localBuckets struct {
+	idleTimeout time.Duration
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+func (b *localBuckets) TakeToken(ctx context.Context, key string, rate float64, burst int, now time.Time) (bool, float64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if now.Sub(b.lastSweep) > b.idleTimeout {
+		b.sweep(now)
+	}
+
+	current, ok := b.buckets[key]
+	if !ok {
+		current = &bucket{tokens: float64(burst), updated: now}
+		b.buckets[key] = current
+	}
+	if elapsed := now.Sub(current.updated); elapsed > 0 {
+		current.tokens = math.Min(float64(burst), current.tokens+elapsed.Seconds()*rate)
+		current.updated = now
+	}
+	if current.tokens < 1 {
+		return false, current.tokens, nil
+	}
+	current.tokens--
+	return true, current.tokens, nil
+}
+
+//sweep forgets the clients which haven't made requests for a while, their buckets would have been full anyway
+func (b *localBuckets) sweep(now time.Time) {
+	for key, current := range b.buckets {
+		if now.Sub(current.updated) > b.idleTimeout {
+			delete(b.buckets, key)
+		}
+	}
+	b.lastSweep = now
+}
+
+func NewLocalBuckets(cfg *Config) *localBuckets {
+	return &localBuckets{
+		idleTimeout: cfg.IdleTimeout,
+		buckets:     map[string]*bucket{},
+	}
+}
@@ -0,0 +1,51 @@
+package ratelimit
+
+import "time"
+
+const (
+	LocalMode = "local"
+	RedisMode = "redis"
+)
+
+type Config struct {
+	Disabled bool `env:"RATELIMIT_DISABLED,default=false"`
+	//Mode is either local, where every instance counts on its own, or redis, where the instances share the buckets
+	Mode string `env:"RATELIMIT_MODE,default=local"`
+	//TrustedProxies are the IPs and the CIDRs of the proxies whose X-Forwarded-For is believed
+	TrustedProxies []string `env:"RATELIMIT_TRUSTEDPROXIES"`
+	KeyPrefix      string   `env:"RATELIMIT_KEYPREFIX,default=ratelimit"`
+	//The rates are the requests per second, the bursts are the requests which may be made at once. The zero rate
+	//turns the limit of the kind off.
+	CreateRate  float64 `env:"RATELIMIT_CREATE_RATE,default=5"`
+	CreateBurst int     `env:"RATELIMIT_CREATE_BURST,default=20"`
+	//RedirectRate is off by default, because all the clients behind a proxy which isn't trusted share one bucket
+	RedirectRate  float64 `env:"RATELIMIT_REDIRECT_RATE,default=0"`
+	RedirectBurst int     `env:"RATELIMIT_REDIRECT_BURST,default=100"`
+	AuthRate      float64 `env:"RATELIMIT_AUTH_RATE,default=50"`
+	AuthBurst     int     `env:"RATELIMIT_AUTH_BURST,default=100"`
+	//IdleTimeout is how long the local buckets of the clients which don't make requests are kept
+	IdleTimeout time.Duration `env:"RATELIMIT_IDLETIMEOUT,default=10m"`
+}
+
+//The kinds of the requests limited separately
+const (
+	Create   = "create"
+	Redirect = "redirect"
+	//Auth is any request to the routes with the API keys, it's limited by the IP before the key is looked up, so
+	//the requests with the invalid keys don't reach the storage at any rate
+	Auth = "auth"
+)
+
+//policy is the rate and the burst of a kind of the requests
+type policy struct {
+	rate  float64
+	burst int
+}
+
+func (c *Config) policies() map[string]policy {
+	return map[string]policy{
+		Create:   {rate: c.CreateRate, burst: c.CreateBurst},
+		Redirect: {rate: c.RedirectRate, burst: c.RedirectBurst},
+		Auth:     {rate: c.AuthRate, burst: c.AuthBurst},
+	}
+}
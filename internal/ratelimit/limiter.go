@@ -0,0 +1,125 @@
+package ratelimit
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/render"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"url-shortener/internal/auth"
+	"url-shortener/internal/chi_utils"
+	httplogger "url-shortener/internal/logger/http"
+	"url-shortener/internal/net_utils"
+)
+
+var (
+	ErrTooManyRequests = errors.New("Too many requests")
+)
+
+var rejectedRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "url_shortener",
+	Subsystem: "ratelimit",
+	Name:      "rejected_requests_total",
+	Help:      "The requests rejected because the clients have exceeded the rate.",
+}, []string{"kind"})
+
+type limiter struct {
+	disabled       bool
+	prefix         string
+	trustedProxies []*net.IPNet
+	policies       map[string]policy
+	buckets        Buckets
+	now            func() time.Time
+}
+
+//Limit lets through the requests of the client within the rate of their kind. The clients are told apart by
+//their API keys, the anonymous ones by their IPs, the requests whose IP is unknown aren't limited rather than
+//share one bucket. The requests are let through if the buckets are unavailable, so the limiter doesn't make the
+//outage of the storage worse.
+func (l *limiter) Limit(kind string) func(http.Handler) http.Handler {
+	policy, ok := l.policies[kind]
+	if !ok {
+		panic(fmt.Sprintf("The kind of the requests %q is unknown", kind))
+	}
+	return func(next http.Handler) http.Handler {
+		if l.disabled || policy.rate == 0 {
+			return next
+		}
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			client, ok := l.client(r)
+			if !ok {
+				httplogger.FromRequest(r).Debug().Str("remote_addr", r.RemoteAddr).Msg("The client cannot be identified")
+				next.ServeHTTP(w, r)
+				return
+			}
+			key := fmt.Sprintf("%s:%s:%s", l.prefix, kind, client)
+			allowed, tokens, err := l.buckets.TakeToken(r.Context(), key, policy.rate, policy.burst, l.now())
+			if err != nil {
+				httplogger.FromRequest(r).Error().Err(err).Str("client", client).Msg("Cannot check the rate")
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			header := w.Header()
+			header.Set("RateLimit-Limit", strconv.Itoa(policy.burst))
+			header.Set("RateLimit-Remaining", strconv.Itoa(int(tokens)))
+			header.Set("RateLimit-Reset", strconv.Itoa(seconds(float64(policy.burst)-tokens, policy.rate)))
+			if !allowed {
+				rejectedRequests.WithLabelValues(kind).Inc()
+				httplogger.FromRequest(r).Debug().Str("client", client).Str("kind", kind).Msg("The rate has been exceeded")
+				header.Set("Retry-After", strconv.Itoa(seconds(1-tokens, policy.rate)))
+				render.Render(w, r, chi_utils.TooManyRequests(ErrTooManyRequests))
+				return
+			}
+			next.ServeHTTP(w, r)
+		}
+		return http.HandlerFunc(fn)
+	}
+}
+
+func (l *limiter) client(r *http.Request) (string, bool) {
+	if key, ok := auth.FromContext(r.Context()); ok {
+		return "key:" + key.Name, true
+	}
+	ip := net_utils.ClientIP(r.RemoteAddr, r.Header["X-Forwarded-For"], l.trustedProxies)
+	if ip == nil {
+		return "", false
+	}
+	return "ip:" + ip.String(), true
+}
+
+//seconds returns how long it takes to get the tokens, rounded up to the whole seconds
+func seconds(tokens float64, rate float64) int {
+	if tokens <= 0 {
+		return 0
+	}
+	return int(math.Ceil(tokens / rate))
+}
+
+func NewLimiter(cfg *Config, buckets Buckets) (*limiter, error) {
+	policies := cfg.policies()
+	for kind, policy := range policies {
+		if policy.rate < 0 || policy.rate > 0 && policy.burst < 1 {
+			return nil, fmt.Errorf("The rate of the %s requests mustn't be negative and the burst must be positive", kind)
+		}
+	}
+	trustedProxies, err := net_utils.ParseNetworks(cfg.TrustedProxies)
+	if err != nil {
+		return nil, fmt.Errorf("The trusted proxies are invalid: %w", err)
+	}
+	return &limiter{
+		disabled:       cfg.Disabled,
+		prefix:         cfg.KeyPrefix,
+		trustedProxies: trustedProxies,
+		policies:       policies,
+		buckets:        buckets,
+		now:            time.Now,
+	}, nil
+}
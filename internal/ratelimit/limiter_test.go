@@ -0,0 +1,146 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/stretchr/testify/assert"
+
+	"url-shortener/internal/auth"
+)
+
+type failingBuckets struct{}
+
+func (failingBuckets) TakeToken(ctx context.Context, key string, rate float64, burst int, now time.Time) (bool, float64, error) {
+	return false, 0, errors.New("connection refused")
+}
+
+func TestLimiter(t *testing.T) {
+	Convey("Test the rate limiting", t, func() {
+		cfg := &Config{
+			Mode:           LocalMode,
+			TrustedProxies: []string{"10.0.0.1"},
+			KeyPrefix:      "ratelimit",
+			CreateRate:     0.5,
+			CreateBurst:    2,
+			RedirectRate:   10,
+			RedirectBurst:  10,
+			AuthRate:       10,
+			AuthBurst:      10,
+			IdleTimeout:    time.Minute,
+		}
+		l, err := NewLimiter(cfg, NewLocalBuckets(cfg))
+		assert.NoError(t, err)
+		now := time.Date(2020, 3, 15, 10, 30, 0, 0, time.UTC)
+		l.now = func() time.Time { return now }
+
+		handler := l.Limit(Create)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		requestVia := func(remoteAddr string, forwardedFor string, key *auth.Key) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodPost, "http://blablabla.me/", nil)
+			req.RemoteAddr = remoteAddr
+			req.Header.Set("X-Forwarded-For", forwardedFor)
+			if key != nil {
+				req = req.WithContext(auth.WithKey(req.Context(), key))
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			return w
+		}
+		request := func(remoteAddr string, key *auth.Key) *httptest.ResponseRecorder {
+			return requestVia(remoteAddr, "5.6.7.8", key)
+		}
+
+		Convey("It rejects the requests over the burst until the tokens are refilled", func() {
+			w := request("1.2.3.4:5678", nil)
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, "2", w.Header().Get("RateLimit-Limit"))
+			assert.Equal(t, "1", w.Header().Get("RateLimit-Remaining"))
+			assert.Equal(t, "2", w.Header().Get("RateLimit-Reset"))
+
+			assert.Equal(t, http.StatusOK, request("1.2.3.4:5678", nil).Code)
+			w = request("1.2.3.4:5678", nil)
+			assert.Equal(t, http.StatusTooManyRequests, w.Code)
+			assert.Equal(t, "0", w.Header().Get("RateLimit-Remaining"))
+			assert.Equal(t, "2", w.Header().Get("Retry-After"))
+			assert.JSONEq(t, `{"errors": [{"code": 429, "description": "Too many requests"}]}`, w.Body.String())
+
+			now = now.Add(2 * time.Second)
+			assert.Equal(t, http.StatusOK, request("1.2.3.4:5678", nil).Code)
+			assert.Equal(t, http.StatusTooManyRequests, request("1.2.3.4:5678", nil).Code)
+		})
+
+		Convey("It limits the clients separately", func() {
+			request("1.2.3.4:5678", nil)
+			request("1.2.3.4:5678", nil)
+
+			assert.Equal(t, http.StatusOK, request("1.2.3.5:5678", nil).Code)
+			assert.Equal(t, http.StatusOK, request("1.2.3.4:5678", &auth.Key{Name: "marketing"}).Code)
+			assert.Equal(t, http.StatusOK, request("10.0.0.1:5678", nil).Code)
+		})
+
+		Convey("It limits the clients behind the trusted proxy by their IPs", func() {
+			requestVia("10.0.0.1:5678", "5.6.7.8", nil)
+			requestVia("10.0.0.1:5678", "5.6.7.8", nil)
+			assert.Equal(t, http.StatusTooManyRequests, requestVia("10.0.0.1:5678", "5.6.7.8", nil).Code)
+
+			assert.Equal(t, http.StatusOK, requestVia("10.0.0.1:5678", "5.6.7.9", nil).Code)
+			assert.Equal(t, http.StatusOK, requestVia("10.0.0.1:5678", "1.1.1.1, 5.6.7.10", nil).Code)
+			assert.Equal(t, http.StatusOK, requestVia("1.2.3.4:5678", "", nil).Code)
+		})
+
+		Convey("It ignores X-Forwarded-For of the untrusted peers", func() {
+			requestVia("1.2.3.4:5678", "5.6.7.8", nil)
+			requestVia("1.2.3.4:5678", "5.6.7.9", nil)
+			assert.Equal(t, http.StatusTooManyRequests, requestVia("1.2.3.4:5678", "5.6.7.10", nil).Code)
+
+			assert.Equal(t, http.StatusOK, requestVia("1.2.3.5:5678", "5.6.7.8", nil).Code)
+			assert.Equal(t, http.StatusTooManyRequests, requestVia("10.0.0.1:5678", "1.2.3.4", nil).Code)
+		})
+
+		Convey("It doesn't put the clients with unknown IPs into one bucket", func() {
+			for i := 0; i < 3; i++ {
+				assert.Equal(t, http.StatusOK, request("", nil).Code)
+				assert.Equal(t, http.StatusOK, request("@", nil).Code)
+			}
+			assert.Equal(t, http.StatusOK, request("1.2.3.4:5678", nil).Code)
+			assert.Equal(t, http.StatusOK, request("1.2.3.4:5678", nil).Code)
+			assert.Equal(t, http.StatusTooManyRequests, request("1.2.3.4:5678", nil).Code)
+		})
+
+		Convey("It doesn't limit the kind with the zero rate", func() {
+			cfg.RedirectRate = 0
+			l, err := NewLimiter(cfg, NewLocalBuckets(cfg))
+			assert.NoError(t, err)
+			handler := l.Limit(Redirect)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			for i := 0; i < 20; i++ {
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://blablabla.me/qwe", nil))
+				assert.Equal(t, http.StatusOK, w.Code)
+				assert.Empty(t, w.Header().Get("RateLimit-Limit"))
+			}
+		})
+
+		Convey("It lets the requests through if the buckets are unavailable", func() {
+			l.buckets = failingBuckets{}
+			for i := 0; i < 3; i++ {
+				assert.Equal(t, http.StatusOK, request("1.2.3.4:5678", nil).Code)
+			}
+		})
+	})
+
+	Convey("The invalid policies are rejected", t, func() {
+		_, err := NewLimiter(&Config{CreateRate: 1, CreateBurst: 1, RedirectRate: -1, RedirectBurst: 1, AuthRate: 1, AuthBurst: 1}, nil)
+		assert.Error(t, err)
+		_, err = NewLimiter(&Config{CreateRate: 1, CreateBurst: 0, RedirectRate: 1, RedirectBurst: 1, AuthRate: 1, AuthBurst: 1}, nil)
+		assert.Error(t, err)
+		_, err = NewLimiter(&Config{CreateRate: 1, CreateBurst: 1, RedirectRate: 1, RedirectBurst: 1, AuthRate: 1, AuthBurst: 0}, nil)
+		assert.Error(t, err)
+		_, err = NewLimiter(&Config{CreateRate: 1, CreateBurst: 1, RedirectRate: 0, RedirectBurst: 0, AuthRate: 1, AuthBurst: 1}, nil)
+		assert.NoError(t, err)
+	})
+}
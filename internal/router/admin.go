@@ -0,0 +1,97 @@
+package router
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+	"github.com/go-chi/render"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"url-shortener/internal/chi_utils"
+	"url-shortener/internal/logger"
+	httplogger "url-shortener/internal/logger/http"
+	"url-shortener/internal/net_utils"
+)
+
+var (
+	errInvalidToken     = errors.New("The admin token is missing or invalid")
+	errForbiddenAddress = errors.New("The address isn't allowed")
+)
+
+type AdminConfig struct {
+	//Token is required as the bearer token if set, it isn't logged with the config
+	Token string `env:"ADMIN_TOKEN" json:"-"`
+	//AllowedNetworks are the IPs and the CIDRs which the requests are accepted from if set
+	AllowedNetworks []string `env:"ADMIN_ALLOWEDNETWORKS"`
+}
+
+type Health interface {
+	Liveness(w http.ResponseWriter, r *http.Request)
+	Readiness(w http.ResponseWriter, r *http.Request)
+}
+
+//NewAdminRouter serves the /internal routes, which aren't exposed to the clients. The profiler and the metrics
+//are guarded, the health probes are open, so the orchestrators don't need the credentials.
+func NewAdminRouter(cfg *AdminConfig, logger *logger.Logger, health Health) (http.Handler, error) {
+	networks, err := net_utils.ParseNetworks(cfg.AllowedNetworks)
+	if err != nil {
+		return nil, fmt.Errorf("The allowed networks are invalid: %w", err)
+	}
+
+	r := chi.NewRouter()
+	{
+		r.Use(httplogger.NewHandler(*logger))
+		r.Use(httplogger.Recoverer)
+
+		r.Route("/internal", func(r chi.Router) {
+			r.Get("/healthz", health.Liveness)
+			r.Get("/readyz", health.Readiness)
+			r.Group(func(r chi.Router) {
+				if len(networks) > 0 {
+					r.Use(allowNetworks(networks))
+				}
+				if cfg.Token != "" {
+					r.Use(requireToken(cfg.Token))
+				}
+				r.Mount("/debug", middleware.Profiler())
+				r.Handle("/metrics", promhttp.Handler())
+			})
+		})
+	}
+	return r, nil
+}
+
+//allowNetworks checks the address of the peer, the forwarded addresses are ignored since they can be forged
+func allowNetworks(networks []*net.IPNet) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			if net_utils.Contains(networks, net_utils.RemoteIP(r.RemoteAddr)) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			httplogger.FromRequest(r).Warn().Str("address", r.RemoteAddr).Msg("The admin request has been rejected")
+			render.Render(w, r, chi_utils.Forbidden(errForbiddenAddress))
+		}
+		return http.HandlerFunc(fn)
+	}
+}
+
+func requireToken(token string) func(http.Handler) http.Handler {
+	expected := []byte("Bearer " + token)
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				render.Render(w, r, chi_utils.Unauthorized(errInvalidToken))
+				return
+			}
+			next.ServeHTTP(w, r)
+		}
+		return http.HandlerFunc(fn)
+	}
+}
@@ -0,0 +1,74 @@
+package router
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/stretchr/testify/assert"
+
+	"url-shortener/internal/logger"
+)
+
+type stubHealth struct{}
+
+func (stubHealth) Liveness(w http.ResponseWriter, r *http.Request) {}
+
+func (stubHealth) Readiness(w http.ResponseWriter, r *http.Request) {}
+
+func TestNewAdminRouter(t *testing.T) {
+	l := &logger.Logger{}
+	request := func(handler http.Handler, path string, remoteAddr string, authorization string) int {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = remoteAddr
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	Convey("The routes are open without the guards", t, func() {
+		r, err := NewAdminRouter(&AdminConfig{}, l, stubHealth{})
+		assert.NoError(t, err)
+
+		assert.Equal(t, http.StatusOK, request(r, "/internal/metrics", "1.2.3.4:5678", ""))
+		assert.Equal(t, http.StatusOK, request(r, "/internal/debug/vars", "1.2.3.4:5678", ""))
+	})
+
+	Convey("The token is required", t, func() {
+		r, err := NewAdminRouter(&AdminConfig{Token: "secret"}, l, stubHealth{})
+		assert.NoError(t, err)
+
+		assert.Equal(t, http.StatusUnauthorized, request(r, "/internal/metrics", "1.2.3.4:5678", ""))
+		assert.Equal(t, http.StatusUnauthorized, request(r, "/internal/metrics", "1.2.3.4:5678", "Bearer wrong"))
+		assert.Equal(t, http.StatusOK, request(r, "/internal/metrics", "1.2.3.4:5678", "Bearer secret"))
+		assert.Equal(t, http.StatusOK, request(r, "/internal/readyz", "1.2.3.4:5678", ""))
+	})
+
+	Convey("The requests are accepted only from the allowed networks", t, func() {
+		r, err := NewAdminRouter(&AdminConfig{AllowedNetworks: []string{"10.0.0.0/8", "::1"}}, l, stubHealth{})
+		assert.NoError(t, err)
+
+		assert.Equal(t, http.StatusOK, request(r, "/internal/metrics", "10.1.2.3:5678", ""))
+		assert.Equal(t, http.StatusOK, request(r, "/internal/metrics", "[::1]:5678", ""))
+		assert.Equal(t, http.StatusForbidden, request(r, "/internal/metrics", "1.2.3.4:5678", ""))
+		assert.Equal(t, http.StatusOK, request(r, "/internal/healthz", "1.2.3.4:5678", ""))
+	})
+
+	Convey("The invalid networks are rejected", t, func() {
+		_, err := NewAdminRouter(&AdminConfig{AllowedNetworks: []string{"10.0.0.0/33"}}, l, stubHealth{})
+		assert.Error(t, err)
+		_, err = NewAdminRouter(&AdminConfig{AllowedNetworks: []string{"localhost"}}, l, stubHealth{})
+		assert.Error(t, err)
+	})
+}
+
+func TestAdminConfigLogging(t *testing.T) {
+	data, err := json.Marshal(&AdminConfig{Token: "secret", AllowedNetworks: []string{"10.0.0.0/8"}})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"AllowedNetworks": ["10.0.0.0/8"]}`, string(data))
+}
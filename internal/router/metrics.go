@@ -0,0 +1,72 @@
+package router
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	requestsCount = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "url_shortener",
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "The handled requests by the route and the status code.",
+	}, []string{"method", "route", "code"})
+	requestsDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "url_shortener",
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "The time taken to handle the requests by the route and the status code.",
+		Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"method", "route", "code"})
+)
+
+//knownMethods are counted by their names, the rest are counted as OTHER, so the clients cannot produce new series
+//with arbitrary methods
+var knownMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodPost:    true,
+	http.MethodPut:     true,
+	http.MethodPatch:   true,
+	http.MethodDelete:  true,
+	http.MethodConnect: true,
+	http.MethodOptions: true,
+	http.MethodTrace:   true,
+}
+
+func methodLabel(method string) string {
+	if knownMethods[method] {
+		return method
+	}
+	return "OTHER"
+}
+
+//measureRequests counts the requests by the patterns of the routes rather than the paths, so the slugs don't
+//produce a new series each
+func measureRequests(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+
+		route := chi.RouteContext(r.Context()).RoutePattern()
+		if route == "" {
+			route = "unknown"
+		}
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		labels := prometheus.Labels{"method": methodLabel(r.Method), "route": route, "code": strconv.Itoa(status)}
+		requestsCount.With(labels).Inc()
+		requestsDuration.With(labels).Observe(time.Since(start).Seconds())
+	}
+	return http.HandlerFunc(fn)
+}
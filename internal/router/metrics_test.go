@@ -0,0 +1,46 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMeasureRequests(t *testing.T) {
+	Convey("The requests are counted by the routes", t, func() {
+		r := chi.NewRouter()
+		r.Use(measureRequests)
+		r.Get("/{slug}", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusMovedPermanently)
+		})
+		r.Get("/{slug}/stats", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("{}"))
+		})
+
+		for _, path := range []string{"/qwe", "/asd", "/qwe/stats", "/qwe/stats/all"} {
+			r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+		}
+
+		assert.Equal(t, float64(2), testutil.ToFloat64(requestsCount.WithLabelValues(http.MethodGet, "/{slug}", "301")))
+		assert.Equal(t, float64(1), testutil.ToFloat64(requestsCount.WithLabelValues(http.MethodGet, "/{slug}/stats", "200")))
+		assert.Equal(t, float64(1), testutil.ToFloat64(requestsCount.WithLabelValues(http.MethodGet, "unknown", "404")))
+	})
+
+	Convey("The unknown methods are counted together", t, func() {
+		r := chi.NewRouter()
+		r.Use(measureRequests)
+		r.HandleFunc("/{slug}", func(w http.ResponseWriter, r *http.Request) {})
+
+		for _, method := range []string{"FOO", "BAR", "get"} {
+			r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(method, "/qwe", nil))
+		}
+
+		// chi rejects the methods it doesn't know, but they are still counted
+		assert.Equal(t, float64(3), testutil.ToFloat64(requestsCount.WithLabelValues("OTHER", "unknown", "405")))
+	})
+}
@@ -4,25 +4,43 @@ import (
 	"net/http"
 
 	"github.com/go-chi/chi"
-	"github.com/go-chi/chi/middleware"
 	"github.com/opentracing/opentracing-go"
 	"github.com/opentracing/opentracing-go/log"
 
+	"url-shortener/internal/auth"
 	"url-shortener/internal/logger"
 	httplogger "url-shortener/internal/logger/http"
+	"url-shortener/internal/ratelimit"
 )
 
 type Handlers interface {
 	CreateShortLink(w http.ResponseWriter, r *http.Request)
+	CreateShortLinks(w http.ResponseWriter, r *http.Request)
 	OpenShortLink(w http.ResponseWriter, r *http.Request)
+	GetShortLinkStats(w http.ResponseWriter, r *http.Request)
+	GetShortLink(w http.ResponseWriter, r *http.Request)
+	UpdateShortLink(w http.ResponseWriter, r *http.Request)
+	DisableShortLink(w http.ResponseWriter, r *http.Request)
 }
 
-func NewRouter(cfg *Config, logger *logger.Logger, handlers Handlers) http.Handler {
+type Authenticator interface {
+	Require(scope string) func(http.Handler) http.Handler
+}
+
+type Limiter interface {
+	Limit(kind string) func(http.Handler) http.Handler
+}
+
+//NewRouter serves the API with the authentication, the redirects stay anonymous. The API is limited by the IPs
+//before the authentication, so the invalid keys cost nothing, and the creation is limited after it, so the clients
+//with the API keys are limited by the keys rather than the IPs.
+func NewRouter(cfg *Config, logger *logger.Logger, handlers Handlers, authenticator Authenticator, limiter Limiter) http.Handler {
 	r := chi.NewRouter()
 	{
 		r.Use(httplogger.NewHandler(*logger))
 		r.Use(httplogger.Recoverer)
 		r.Use(httplogger.RequestIDHandler("id_request", "X-Request-ID"))
+		r.Use(measureRequests)
 		if !cfg.JaegerDisabled {
 			r.Use(func(next http.Handler) http.Handler {
 				fn := func(w http.ResponseWriter, r *http.Request) {
@@ -47,10 +65,19 @@ func NewRouter(cfg *Config, logger *logger.Logger, handlers Handlers) http.Handl
 			r.Use(httplogger.RequestBody)
 		}
 
-		r.Post("/", handlers.CreateShortLink)
-		r.Get("/{slug}", handlers.OpenShortLink)
-		r.Route("/internal", func(r chi.Router) {
-			r.Mount("/debug", middleware.Profiler())
+		// The links with 307 and 308 redirect codes keep the method, so all of them are redirected
+		r.With(limiter.Limit(ratelimit.Redirect)).HandleFunc("/{slug}", handlers.OpenShortLink)
+		r.Group(func(r chi.Router) {
+			r.Use(limiter.Limit(ratelimit.Auth))
+			r.With(authenticator.Require(auth.ScopeCreate), limiter.Limit(ratelimit.Create)).Post("/", handlers.CreateShortLink)
+			r.With(authenticator.Require(auth.ScopeRead)).Get("/{slug}/stats", handlers.GetShortLinkStats)
+		})
+		r.Route("/api", func(r chi.Router) {
+			r.Use(limiter.Limit(ratelimit.Auth))
+			r.With(authenticator.Require(auth.ScopeCreate), limiter.Limit(ratelimit.Create)).Post("/links/batch", handlers.CreateShortLinks)
+			r.With(authenticator.Require(auth.ScopeRead)).Get("/links/{slug}", handlers.GetShortLink)
+			r.With(authenticator.Require(auth.ScopeUpdate)).Patch("/links/{slug}", handlers.UpdateShortLink)
+			r.With(authenticator.Require(auth.ScopeDelete)).Delete("/links/{slug}", handlers.DisableShortLink)
 		})
 	}
 	return r
@@ -0,0 +1,91 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/stretchr/testify/assert"
+
+	"url-shortener/internal/logger"
+	"url-shortener/internal/ratelimit"
+)
+
+type stubHandlers struct{}
+
+func (stubHandlers) CreateShortLink(w http.ResponseWriter, r *http.Request)   {}
+func (stubHandlers) CreateShortLinks(w http.ResponseWriter, r *http.Request)  {}
+func (stubHandlers) OpenShortLink(w http.ResponseWriter, r *http.Request)     {}
+func (stubHandlers) GetShortLinkStats(w http.ResponseWriter, r *http.Request) {}
+func (stubHandlers) GetShortLink(w http.ResponseWriter, r *http.Request)      {}
+func (stubHandlers) UpdateShortLink(w http.ResponseWriter, r *http.Request)   {}
+func (stubHandlers) DisableShortLink(w http.ResponseWriter, r *http.Request)  {}
+
+//recorder keeps the order which the middlewares are called in, the limiter rejects the kinds of the requests
+//in rejected
+type recorder struct {
+	calls    []string
+	rejected map[string]bool
+}
+
+func (rec *recorder) Require(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rec.calls = append(rec.calls, "auth:"+scope)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func (rec *recorder) Limit(kind string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rec.calls = append(rec.calls, "limit:"+kind)
+			if rec.rejected[kind] {
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func TestNewRouter(t *testing.T) {
+	Convey("Test the order of the middlewares", t, func() {
+		rec := &recorder{rejected: map[string]bool{}}
+		r := NewRouter(&Config{JaegerDisabled: true}, &logger.Logger{}, stubHandlers{}, rec, rec)
+		request := func(method string, path string) int {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+			return w.Code
+		}
+
+		Convey("The API is limited by the IPs before the authentication", func() {
+			rec.rejected[ratelimit.Auth] = true
+
+			for _, route := range [][2]string{
+				{http.MethodPost, "/"},
+				{http.MethodGet, "/qwe/stats"},
+				{http.MethodPost, "/api/links/batch"},
+				{http.MethodGet, "/api/links/qwe"},
+				{http.MethodPatch, "/api/links/qwe"},
+				{http.MethodDelete, "/api/links/qwe"},
+			} {
+				rec.calls = nil
+				assert.Equal(t, http.StatusTooManyRequests, request(route[0], route[1]), route[1])
+				assert.Equal(t, []string{"limit:auth"}, rec.calls, route[1])
+			}
+		})
+
+		Convey("The creation is limited after the authentication", func() {
+			assert.Equal(t, http.StatusOK, request(http.MethodPost, "/"))
+			assert.Equal(t, []string{"limit:auth", "auth:links:create", "limit:create"}, rec.calls)
+		})
+
+		Convey("The redirects aren't authenticated", func() {
+			assert.Equal(t, http.StatusOK, request(http.MethodGet, "/qwe"))
+			assert.Equal(t, []string{"limit:redirect"}, rec.calls)
+		})
+	})
+}
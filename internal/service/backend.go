@@ -0,0 +1,67 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"url-shortener/internal/analytics"
+	"url-shortener/internal/ratelimit"
+	"url-shortener/internal/storage"
+	"url-shortener/internal/storage/bolt"
+	"url-shortener/internal/storage/memory"
+	"url-shortener/internal/storage/postgres"
+	"url-shortener/internal/storage/redis"
+)
+
+const (
+	redisBackend    = "redis"
+	memoryBackend   = "memory"
+	boltBackend     = "bolt"
+	postgresBackend = "postgres"
+)
+
+//backend is everything the service keeps in the storage: the links, the slug indices and the hits
+type backend interface {
+	storage.Storage
+	analytics.Storage
+
+	NextInstanceIndex() (int64, error)
+	ReserveBlock(ctx context.Context, size int64) (start int64, err error)
+	ReleaseBlock(ctx context.Context, start int64, end int64) error
+	ReclaimBlock(ctx context.Context) (start int64, end int64, err error)
+
+	Ping(ctx context.Context) error
+	Close() error
+}
+
+func newBackend(cfg *Config) (backend, error) {
+	switch cfg.StorageBackend {
+	case redisBackend:
+		return redis.NewStorage(&cfg.Redis)
+	case memoryBackend:
+		return memory.NewStorage(), nil
+	case boltBackend:
+		return bolt.NewStorage(&cfg.Bolt)
+	case postgresBackend:
+		if cfg.Postgres.DSN == "" {
+			return nil, errors.New("The postgres DSN must be set")
+		}
+		return postgres.NewStorage(&cfg.Postgres)
+	}
+	return nil, fmt.Errorf("The storage backend %q is not supported", cfg.StorageBackend)
+}
+
+//newBuckets shares the rate limits between the instances through Redis in the redis mode
+func newBuckets(cfg *Config, backend backend) (ratelimit.Buckets, error) {
+	switch cfg.RateLimit.Mode {
+	case ratelimit.LocalMode:
+		return ratelimit.NewLocalBuckets(&cfg.RateLimit), nil
+	case ratelimit.RedisMode:
+		if buckets, ok := backend.(ratelimit.Buckets); ok {
+			return buckets, nil
+		}
+		return nil, fmt.Errorf("The rate limiter cannot keep the buckets in the %s storage backend", cfg.StorageBackend)
+	}
+	return nil, fmt.Errorf("The rate limiter mode %q is unknown", cfg.RateLimit.Mode)
+}
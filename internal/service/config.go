@@ -3,20 +3,47 @@ package service
 import (
 	"time"
 
+	"url-shortener/internal/analytics"
+	"url-shortener/internal/auth"
+	"url-shortener/internal/health"
+	"url-shortener/internal/idempotency"
 	"url-shortener/internal/jaeger"
 	"url-shortener/internal/logger"
+	"url-shortener/internal/ratelimit"
 	"url-shortener/internal/router"
 	"url-shortener/internal/slugs"
+	"url-shortener/internal/storage"
+	"url-shortener/internal/storage/bolt"
+	"url-shortener/internal/storage/postgres"
 	"url-shortener/internal/storage/redis"
+	"url-shortener/internal/urlpolicy"
 )
 
 type Config struct {
-	Jaeger jaeger.Config
-	Logger logger.Config
-	Redis  redis.Config
-	Router router.Config
-	Slugs  slugs.Config
+	Admin       router.AdminConfig
+	Analytics   analytics.Config
+	Auth        auth.Config
+	Bolt        bolt.Config
+	Cache       storage.CacheConfig
+	Health      health.Config
+	Idempotency idempotency.Config
+	Jaeger      jaeger.Config
+	Logger      logger.Config
+	Postgres    postgres.Config
+	RateLimit   ratelimit.Config
+	Redis       redis.Config
+	Router      router.Config
+	Slugs       slugs.Config
+	URLPolicy   urlpolicy.Config
 
+	StorageBackend  string        `env:"STORAGE_BACKEND,default=redis"`
 	Address         string        `env:"LISTEN_ADDRESS,default=:8080"`
+	AdminAddress    string        `env:"ADMIN_LISTEN_ADDRESS,default=:8081"`
 	ShutdownTimeout time.Duration `env:"SHUTDOWN_TIMEOUT,default=3s"`
+	//ShutdownDelay is how long the service keeps serving after it has become not ready, so the load balancers
+	//notice it, zero stops the listening at once
+	ShutdownDelay time.Duration `env:"SHUTDOWN_DELAY,default=5s"`
+	RedirectCode  int           `env:"REDIRECT_CODE,default=301"`
+	BatchLimit    int           `env:"BATCH_LIMIT,default=50000"`
+	BatchMaxBytes int64         `env:"BATCH_MAXBYTES,default=16777216"`
 }
@@ -2,27 +2,42 @@ package service
 
 import (
 	"context"
+	"expvar"
+	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/oklog/run"
 
+	"url-shortener/internal/analytics"
+	"url-shortener/internal/auth"
 	"url-shortener/internal/handlers"
+	"url-shortener/internal/health"
+	"url-shortener/internal/idempotency"
 	"url-shortener/internal/jaeger"
 	"url-shortener/internal/logger"
+	"url-shortener/internal/ratelimit"
 	"url-shortener/internal/router"
 	"url-shortener/internal/slugs"
 	"url-shortener/internal/storage"
-	"url-shortener/internal/storage/redis"
+	"url-shortener/internal/urlpolicy"
+	"url-shortener/pkg/protocol"
 )
 
 func Run(cfg *Config, l *logger.Logger) error {
+	if !protocol.IsRedirectCode(cfg.RedirectCode) {
+		err := fmt.Errorf("The redirect code %d is not supported", cfg.RedirectCode)
+		l.Error().Err(err).Msg("The config is invalid")
+		return err
+	}
+
 	g := &run.Group{}
 
 	{
-		stop := make(chan os.Signal)
+		stop := make(chan os.Signal, 1)
 		signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
 		g.Add(func() error {
 			<-stop
@@ -34,20 +49,21 @@ func Run(cfg *Config, l *logger.Logger) error {
 	}
 
 	{
-		redis := redis.NewStorage(&cfg.Redis)
+		backend, err := newBackend(cfg)
+		if err != nil {
+			l.Error().Err(err).Msg("Cannot create the storage")
+			return err
+		}
 		defer func() {
-			if err := redis.Close(); err != nil {
+			if err := backend.Close(); err != nil {
 				l.Error().Err(err).Msg("The storage has been closed improperly")
 			}
 		}()
 
-		instanceIndex, err := redis.NextInstanceIndex()
-		if err != nil {
-			l.Error().Err(err).Msg("Cannot retrieve the service instance index")
-			return err
-		}
+		s := storage.MeasureStorage(backend)
 
-		var s storage.Storage = redis
+		checker := health.NewChecker(&cfg.Health)
+		checker.Add("storage", backend.Ping)
 
 		/////////////////////////////////////////////////////////////////////////////
 		if !cfg.Jaeger.Disabled {
@@ -63,6 +79,9 @@ func Run(cfg *Config, l *logger.Logger) error {
 			}()
 
 			s = storage.TraceStorage(s)
+			checker.Add("tracer", func(ctx context.Context) error {
+				return jaeger.Ping(ctx, &cfg.Jaeger)
+			})
 		}
 
 		slugifier, err := slugs.NewHashidsSlugifier(&cfg.Slugs)
@@ -70,38 +89,131 @@ func Run(cfg *Config, l *logger.Logger) error {
 			l.Error().Err(err).Msg("Cannot create a new slugifier")
 			return err
 		}
-		registry := slugs.NewRegistry(slugifier, s, instanceIndex)
-		h := handlers.NewHandlers(cfg.Slugs.MinLength, registry)
-		r := router.NewRouter(&cfg.Router, l, h)
-		srv := http.Server{
-			Addr:    cfg.Address,
-			Handler: r,
+		allocator, err := slugs.NewIndexAllocator(&cfg.Slugs, backend)
+		if err != nil {
+			l.Error().Err(err).Msg("Cannot create a slug index allocator")
+			return err
 		}
-
-		g.Add(func() error {
-			l.Info().Str("address", srv.Addr).Msg("Start listening")
-			if err := srv.ListenAndServe(); err != nil {
-				if err == http.ErrServerClosed {
-					return nil
-				}
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+			defer cancel()
+			if err := allocator.Release(l.WithContext(ctx)); err != nil {
+				l.Error().Err(err).Msg("Cannot release the unused slug indices")
+			}
+		}()
+		//Only the links are cached, the idempotency keys have to be seen by all the instances at once
+		links := s
+		if cfg.Cache.Size > 0 {
+			cache := storage.CacheStorage(&cfg.Cache, s)
+			publishCacheStats(cache)
+			if err := storage.MeasureCache(cache); err != nil {
+				l.Error().Err(err).Msg("Cannot register the metrics of the cache")
 				return err
 			}
-			l.Info().Msg("Listening has been stopped")
-			return nil
-		}, func(err error) {
-			l.Info().Err(err).Msg("Shutting down of listening...")
+			links = cache
+		}
+		registry := slugs.NewRegistry(&cfg.Slugs, slugifier, links, allocator)
 
-			ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
-			ctx = l.WithContext(ctx)
-			defer cancel()
+		//The tracker isn't a part of the group, it's stopped after both listeners have been drained, so the hits
+		//of the redirects served during the shutdown are saved too
+		tracker := analytics.NewTracker(&cfg.Analytics, backend)
+		trackerDone := make(chan struct{})
+		go func() {
+			defer close(trackerDone)
+			if err := tracker.Run(l.WithContext(context.Background())); err != nil {
+				l.Error().Err(err).Msg("The hits tracker has failed")
+			}
+		}()
+		defer func() {
+			tracker.Stop()
+			<-trackerDone
+			l.Info().Msg("The tracked hits have been saved")
+		}()
+
+		keeper := idempotency.NewKeeper(&cfg.Idempotency, s)
 
-			srv.SetKeepAlivesEnabled(false)
-			if err := srv.Shutdown(ctx); err != nil {
-				l.Error().Err(err).Msg("Cannot shut down listening properly")
+		policy := urlpolicy.NewPolicy(&cfg.URLPolicy)
+		h := handlers.NewHandlers(cfg.Slugs.ShortestSlug(), cfg.RedirectCode, cfg.BatchLimit, cfg.BatchMaxBytes, registry, tracker, keeper, policy)
+		authenticator, err := auth.NewAuthenticator(&cfg.Auth, s)
+		if err != nil {
+			l.Error().Err(err).Msg("Cannot create the authenticator")
+			return err
+		}
+		buckets, err := newBuckets(cfg, backend)
+		if err != nil {
+			l.Error().Err(err).Msg("Cannot create the rate limiter buckets")
+			return err
+		}
+		limiter, err := ratelimit.NewLimiter(&cfg.RateLimit, buckets)
+		if err != nil {
+			l.Error().Err(err).Msg("Cannot create the rate limiter")
+			return err
+		}
+		r := router.NewRouter(&cfg.Router, l, h, authenticator, limiter)
+		srv := &http.Server{
+			Addr:    cfg.Address,
+			Handler: r,
+		}
+		serve(g, l, "public", srv, cfg.ShutdownTimeout, func() {
+			checker.Shutdown()
+			if cfg.ShutdownDelay > 0 {
+				l.Info().Dur("delay", cfg.ShutdownDelay).Msg("Waiting for the load balancers to notice the shutdown")
+				time.Sleep(cfg.ShutdownDelay)
 			}
-			l.Info().Msg("The service has been shut down")
 		})
+
+		//The admin listener is added after the public one, so it's shut down after the public one has been drained
+		adminRouter, err := router.NewAdminRouter(&cfg.Admin, l, checker)
+		if err != nil {
+			l.Error().Err(err).Msg("Cannot create the admin router")
+			return err
+		}
+		adminSrv := &http.Server{
+			Addr:    cfg.AdminAddress,
+			Handler: adminRouter,
+		}
+		serve(g, l, "admin", adminSrv, cfg.ShutdownTimeout, func() {})
 	}
 
 	return g.Run()
 }
+
+//serve adds the listener to the group, beforeShutdown is called as soon as the group is interrupted
+func serve(g *run.Group, l *logger.Logger, name string, srv *http.Server, shutdownTimeout time.Duration, beforeShutdown func()) {
+	listenerLogger := l.With().Str("listener", name).Logger()
+	l = &listenerLogger
+	g.Add(func() error {
+		l.Info().Str("address", srv.Addr).Msg("Start listening")
+		if err := srv.ListenAndServe(); err != nil {
+			if err == http.ErrServerClosed {
+				return nil
+			}
+			return err
+		}
+		l.Info().Msg("Listening has been stopped")
+		return nil
+	}, func(err error) {
+		l.Info().Err(err).Msg("Shutting down of listening...")
+		beforeShutdown()
+
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		ctx = l.WithContext(ctx)
+		defer cancel()
+
+		srv.SetKeepAlivesEnabled(false)
+		if err := srv.Shutdown(ctx); err != nil {
+			l.Error().Err(err).Msg("Cannot shut down listening properly")
+		}
+		l.Info().Msg("The listening has been shut down")
+	})
+}
+
+//publishCacheStats exposes the counters of the cache at /internal/debug/vars
+func publishCacheStats(cache interface{ Stats() storage.CacheStats }) {
+	if expvar.Get("storage_cache") != nil {
+		return
+	}
+	expvar.Publish("storage_cache", expvar.Func(func() interface{} {
+		return cache.Stats()
+	}))
+}
@@ -0,0 +1,154 @@
+package slugs
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	"url-shortener/internal/logger"
+	"url-shortener/internal/storage"
+)
+
+//The instance indices produced by the storage start with 1, so the leased blocks never collide with them
+const leasedInstanceIndex = 0
+
+type indexAllocator interface {
+	NextIndex(ctx context.Context) (instanceIndex int64, slugIndex int64, err error)
+	//NextIndices allocates the count of successive slug indices starting with the returned one
+	NextIndices(ctx context.Context, count int64) (instanceIndex int64, firstSlugIndex int64, err error)
+	Release(ctx context.Context) error
+}
+
+//instanceAllocator counts the slugs within the instance index taken at the start of the service
+type instanceAllocator struct {
+	instanceIndex int64
+	slugsCount    int64
+}
+
+func (a *instanceAllocator) NextIndex(ctx context.Context) (int64, int64, error) {
+	allocatedIndices.WithLabelValues("instance").Inc()
+	return a.instanceIndex, atomic.AddInt64(&a.slugsCount, 1) - 1, nil
+}
+
+func (a *instanceAllocator) NextIndices(ctx context.Context, count int64) (int64, int64, error) {
+	allocatedIndices.WithLabelValues("instance").Add(float64(count))
+	return a.instanceIndex, atomic.AddInt64(&a.slugsCount, count) - count, nil
+}
+
+//Release does nothing, the rest of the instance index cannot be used by the other instances anyway
+func (a *instanceAllocator) Release(ctx context.Context) error {
+	return nil
+}
+
+func NewInstanceAllocator(instanceIndex int64) *instanceAllocator {
+	return &instanceAllocator{
+		instanceIndex: instanceIndex,
+	}
+}
+
+type blockStorage interface {
+	ReserveBlock(ctx context.Context, size int64) (start int64, err error)
+	ReleaseBlock(ctx context.Context, start int64, end int64) error
+	ReclaimBlock(ctx context.Context) (start int64, end int64, err error)
+}
+
+type indexStorage interface {
+	blockStorage
+	NextInstanceIndex() (int64, error)
+}
+
+//NewIndexAllocator leases blocks of indices if the block size is set, otherwise it takes a new instance index
+func NewIndexAllocator(cfg *Config, storage indexStorage) (indexAllocator, error) {
+	if cfg.BlockSize > 0 {
+		return NewBlockAllocator(cfg, storage), nil
+	}
+
+	instanceIndex, err := storage.NextInstanceIndex()
+	if err != nil {
+		return nil, err
+	}
+	return NewInstanceAllocator(instanceIndex), nil
+}
+
+//blockAllocator hands out the slug indices from the blocks leased from the storage. The blocks left unused by
+//the instances which were shut down gracefully are reclaimed before reserving new ones.
+type blockAllocator struct {
+	storage blockStorage
+	size    int64
+
+	mu   sync.Mutex
+	next int64
+	end  int64
+}
+
+func (a *blockAllocator) NextIndex(ctx context.Context) (int64, int64, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.next == a.end {
+		start, end, err := a.lease(ctx)
+		if err != nil {
+			return 0, 0, err
+		}
+		logger.Ctx(ctx).Debug().Int64("start", start).Int64("end", end).Msg("A new block of slugs has been leased")
+		a.next, a.end = start, end
+	}
+
+	slugIndex := a.next
+	a.next++
+	allocatedIndices.WithLabelValues("block").Inc()
+	return leasedInstanceIndex, slugIndex, nil
+}
+
+//NextIndices reserves a separate block for the indices, so the current block isn't affected
+func (a *blockAllocator) NextIndices(ctx context.Context, count int64) (int64, int64, error) {
+	start, err := a.storage.ReserveBlock(ctx, count)
+	if err != nil {
+		return 0, 0, err
+	}
+	logger.Ctx(ctx).Debug().Int64("start", start).Int64("count", count).Msg("A block of slugs has been reserved")
+	allocatedIndices.WithLabelValues("block").Add(float64(count))
+	return leasedInstanceIndex, start, nil
+}
+
+func (a *blockAllocator) lease(ctx context.Context) (int64, int64, error) {
+	start, end, err := a.storage.ReclaimBlock(ctx)
+	if err == nil {
+		leasedBlocks.WithLabelValues("reclaimed").Inc()
+		return start, end, nil
+	}
+	if !errors.Is(err, storage.ErrNotFound) {
+		return 0, 0, err
+	}
+
+	start, err = a.storage.ReserveBlock(ctx, a.size)
+	if err != nil {
+		return 0, 0, err
+	}
+	leasedBlocks.WithLabelValues("reserved").Inc()
+	return start, start + a.size, nil
+}
+
+//Release gives the rest of the current block back to the storage
+func (a *blockAllocator) Release(ctx context.Context) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.next == a.end {
+		return nil
+	}
+	if err := a.storage.ReleaseBlock(ctx, a.next, a.end); err != nil {
+		return err
+	}
+	a.next = a.end
+	releasedBlocks.Inc()
+	return nil
+}
+
+func NewBlockAllocator(cfg *Config, storage blockStorage) *blockAllocator {
+	return &blockAllocator{
+		storage: storage,
+		size:    cfg.BlockSize,
+	}
+}
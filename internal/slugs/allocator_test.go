@@ -0,0 +1,202 @@
+package slugs
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"url-shortener/internal/storage"
+)
+
+type mockBlockStorage struct {
+	m *mock.Mock
+}
+
+func (s *mockBlockStorage) ReserveBlock(ctx context.Context, size int64) (int64, error) {
+	args := s.m.Called(ctx, size)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (s *mockBlockStorage) ReleaseBlock(ctx context.Context, start int64, end int64) error {
+	args := s.m.Called(ctx, start, end)
+	return args.Error(0)
+}
+
+func (s *mockBlockStorage) ReclaimBlock(ctx context.Context) (int64, int64, error) {
+	args := s.m.Called(ctx)
+	return args.Get(0).(int64), args.Get(1).(int64), args.Error(2)
+}
+
+func (s *mockBlockStorage) NextInstanceIndex() (int64, error) {
+	args := s.m.Called()
+	return args.Get(0).(int64), args.Error(1)
+}
+
+type syncBlockStorage struct {
+	mu       sync.Mutex
+	reserved int64
+}
+
+func (s *syncBlockStorage) ReserveBlock(ctx context.Context, size int64) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reserved += size
+	return s.reserved - size, nil
+}
+
+func (s *syncBlockStorage) ReleaseBlock(ctx context.Context, start int64, end int64) error {
+	return nil
+}
+
+func (s *syncBlockStorage) ReclaimBlock(ctx context.Context) (int64, int64, error) {
+	return 0, 0, storage.ErrNotFound
+}
+
+func TestNewIndexAllocator(t *testing.T) {
+	Convey("Test NewIndexAllocator", t, func() {
+		m := &mock.Mock{}
+		s := &mockBlockStorage{m: m}
+
+		Convey("It leases blocks if the block size is set", func() {
+			a, err := NewIndexAllocator(&Config{BlockSize: 100}, s)
+
+			m.AssertExpectations(t)
+			assert.NoError(t, err)
+			assert.Equal(t, &blockAllocator{storage: s, size: 100}, a)
+		})
+
+		Convey("It takes a new instance index otherwise", func() {
+			m.
+				On("NextInstanceIndex").Return(int64(8), nil)
+
+			a, err := NewIndexAllocator(&Config{}, s)
+
+			m.AssertExpectations(t)
+			assert.NoError(t, err)
+			assert.Equal(t, &instanceAllocator{instanceIndex: 8}, a)
+		})
+
+		Convey("It fails if the instance index cannot be taken", func() {
+			m.
+				On("NextInstanceIndex").Return(int64(0), errors.New("NextInstanceIndex error"))
+
+			_, err := NewIndexAllocator(&Config{}, s)
+
+			m.AssertExpectations(t)
+			assert.EqualError(t, err, "NextInstanceIndex error")
+		})
+	})
+}
+
+func TestInstanceAllocator(t *testing.T) {
+	a := NewInstanceAllocator(12)
+	for i := int64(0); i < 3; i++ {
+		instanceIndex, slugIndex, err := a.NextIndex(context.TODO())
+		assert.NoError(t, err)
+		assert.Equal(t, int64(12), instanceIndex)
+		assert.Equal(t, i, slugIndex)
+	}
+
+	instanceIndex, firstSlugIndex, err := a.NextIndices(context.TODO(), 100)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(12), instanceIndex)
+	assert.Equal(t, int64(3), firstSlugIndex)
+	_, slugIndex, err := a.NextIndex(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(103), slugIndex)
+
+	assert.NoError(t, a.Release(context.TODO()))
+}
+
+func TestBlockAllocator(t *testing.T) {
+	Convey("Test blockAllocator", t, func() {
+		m := &mock.Mock{}
+		a := NewBlockAllocator(&Config{BlockSize: 2}, &mockBlockStorage{m: m})
+
+		Convey("It reserves a new block if there is nothing to reclaim", func() {
+			m.
+				On("ReclaimBlock", mock.Anything).Return(int64(0), int64(0), storage.ErrNotFound).Twice().
+				On("ReserveBlock", mock.Anything, int64(2)).Return(int64(10), nil).Once().
+				On("ReserveBlock", mock.Anything, int64(2)).Return(int64(30), nil).Once()
+
+			for _, expected := range []int64{10, 11, 30} {
+				instanceIndex, slugIndex, err := a.NextIndex(context.TODO())
+				assert.NoError(t, err)
+				assert.Equal(t, int64(leasedInstanceIndex), instanceIndex)
+				assert.Equal(t, expected, slugIndex)
+			}
+
+			m.AssertExpectations(t)
+		})
+
+		Convey("It reclaims the released blocks first", func() {
+			m.
+				On("ReclaimBlock", mock.Anything).Return(int64(7), int64(8), nil).Once()
+
+			_, slugIndex, err := a.NextIndex(context.TODO())
+
+			m.AssertExpectations(t)
+			assert.NoError(t, err)
+			assert.Equal(t, int64(7), slugIndex)
+		})
+
+		Convey("It fails if the storage has failed", func() {
+			m.
+				On("ReclaimBlock", mock.Anything).Return(int64(0), int64(0), storage.ErrNotFound).Once().
+				On("ReserveBlock", mock.Anything, int64(2)).Return(int64(0), errors.New("ReserveBlock error")).Once()
+
+			_, _, err := a.NextIndex(context.TODO())
+
+			m.AssertExpectations(t)
+			assert.EqualError(t, err, "ReserveBlock error")
+		})
+
+		Convey("It fails if the reclaiming has failed", func() {
+			m.
+				On("ReclaimBlock", mock.Anything).Return(int64(0), int64(0), errors.New("ReclaimBlock error")).Once()
+
+			_, _, err := a.NextIndex(context.TODO())
+
+			m.AssertExpectations(t)
+			assert.EqualError(t, err, "ReclaimBlock error")
+		})
+
+		Convey("It reserves a separate block for the successive indices", func() {
+			m.
+				On("ReserveBlock", mock.Anything, int64(500)).Return(int64(1000), nil).Once()
+
+			instanceIndex, firstSlugIndex, err := a.NextIndices(context.TODO(), 500)
+
+			m.AssertExpectations(t)
+			assert.NoError(t, err)
+			assert.Equal(t, int64(leasedInstanceIndex), instanceIndex)
+			assert.Equal(t, int64(1000), firstSlugIndex)
+			assert.NoError(t, a.Release(context.TODO()))
+		})
+
+		Convey("It releases the rest of the block", func() {
+			m.
+				On("ReclaimBlock", mock.Anything).Return(int64(0), int64(0), storage.ErrNotFound).Once().
+				On("ReserveBlock", mock.Anything, int64(2)).Return(int64(10), nil).Once().
+				On("ReleaseBlock", mock.Anything, int64(11), int64(12)).Return(nil).Once()
+
+			_, _, err := a.NextIndex(context.TODO())
+			assert.NoError(t, err)
+			assert.NoError(t, a.Release(context.TODO()))
+			assert.NoError(t, a.Release(context.TODO()))
+
+			m.AssertExpectations(t)
+		})
+
+		Convey("It has nothing to release if the block is used up", func() {
+			assert.NoError(t, a.Release(context.TODO()))
+
+			m.AssertExpectations(t)
+		})
+	})
+}
@@ -0,0 +1,73 @@
+package slugs
+
+import (
+	"context"
+	"fmt"
+
+	"url-shortener/internal/logger"
+	"url-shortener/internal/storage"
+)
+
+//Registration is the result of registering one link of a batch
+type Registration struct {
+	Slug string
+	Err  error
+}
+
+//RegisterURLs registers the links with the generated slugs all at once: the indices are allocated in one
+//reservation and the records are saved in one round trip. The links which cannot be registered on their own,
+//e.g. with the expiration in the past, are reported in their registrations, the failures of the allocator and
+//the storage fail the whole batch.
+func (r *registry) RegisterURLs(ctx context.Context, links []*Link) ([]Registration, error) {
+	registrations := make([]Registration, len(links))
+	registered := make([]int, 0, len(links))
+	records := make([]storage.Record, 0, len(links))
+	for i, link := range links {
+		expiration, err := r.expiration(link)
+		if err != nil {
+			registrations[i].Err = err
+			continue
+		}
+		registered = append(registered, i)
+		records = append(records, storage.Record{Expiration: expiration})
+	}
+	if len(records) == 0 {
+		return registrations, nil
+	}
+
+	instanceIndex, slugIndex, err := r.allocator.NextIndices(ctx, int64(len(records)))
+	if err != nil {
+		logger.Ctx(ctx).Error().Err(err).Int("count", len(records)).Msg("Cannot allocate slug indices")
+		return nil, err
+	}
+
+	createdAt := r.now().UTC()
+	for n, i := range registered {
+		link := links[i]
+		slug, err := r.slugifier.NewSlug(instanceIndex, slugIndex+int64(n))
+		if err != nil {
+			return nil, err
+		}
+
+		link.CreatedAt = createdAt
+		value, err := encodeLink(link)
+		if err != nil {
+			return nil, err
+		}
+
+		key := fmt.Sprintf("%d:%d", instanceIndex, slugIndex+int64(n))
+		records[n].Key, records[n].Value = key, value
+		if !link.ExpiresAt.IsZero() {
+			records = append(records, r.tombstone(key, link))
+		}
+		registrations[i].Slug = slug
+	}
+
+	if err := r.storage.SaveValues(ctx, records); err != nil {
+		logger.Ctx(ctx).Error().Err(err).Int("count", len(records)).Msg("Cannot create the records")
+		return nil, err
+	}
+	logger.Ctx(ctx).Debug().Int("count", len(registered)).Msg("The batch of links has been registered")
+
+	return registrations, nil
+}
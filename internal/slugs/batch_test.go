@@ -0,0 +1,85 @@
+package slugs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"url-shortener/internal/storage"
+)
+
+func TestRegisterURLs(t *testing.T) {
+	Convey("Test RegisterURLs", t, func() {
+		m := &mock.Mock{}
+
+		a := &instanceAllocator{
+			instanceIndex: 5,
+			slugsCount:    19,
+		}
+		r := registry{
+			custom:    testCustomConfig,
+			slugifier: &mockSlugifier{m: m},
+			now:       func() time.Time { return testNow },
+			storage:   &mockStorage{m: m},
+			allocator: a,
+		}
+
+		Convey("It fails if no indices can be allocated", func() {
+			r.allocator = NewBlockAllocator(&Config{BlockSize: 10}, &mockBlockStorage{m: m})
+			m.
+				On("ReserveBlock", mock.Anything, int64(1)).Return(int64(0), errors.New("ReserveBlock error"))
+
+			_, err := r.RegisterURLs(context.TODO(), []*Link{{URL: "http://en.wikipedia.com"}})
+
+			m.AssertExpectations(t)
+			assert.EqualError(t, err, "ReserveBlock error")
+		})
+
+		Convey("It fails if the records cannot be saved", func() {
+			m.
+				On("NewSlug", int64(5), int64(19)).Return("qwe", nil).
+				On("SaveValues", mock.Anything, mock.Anything).Return(errors.New("saveValues error"))
+
+			_, err := r.RegisterURLs(context.TODO(), []*Link{{URL: "http://en.wikipedia.com"}})
+
+			m.AssertExpectations(t)
+			assert.EqualError(t, err, "saveValues error")
+		})
+
+		Convey("It doesn't allocate indices for the rejected links", func() {
+			registrations, err := r.RegisterURLs(context.TODO(), []*Link{{URL: "http://en.wikipedia.com", ExpiresAt: testNow}})
+
+			m.AssertExpectations(t)
+			assert.NoError(t, err)
+			assert.Equal(t, []Registration{{Err: ErrInvalidExpiration}}, registrations)
+			assert.Equal(t, int64(19), a.slugsCount)
+		})
+
+		Convey("It saves all the records at once", func() {
+			m.
+				On("NewSlug", int64(5), int64(19)).Return("qwe", nil).
+				On("NewSlug", int64(5), int64(20)).Return("asd", nil).
+				On("SaveValues", mock.Anything, []storage.Record{
+					{Key: "5:19", Value: testRecord},
+					{Key: "5:20", Value: testExpiringRecord, Expiration: time.Hour},
+					{Key: "expired:{5:20}", Value: "2020-03-15T11:30:00Z"},
+				}).Return(nil)
+
+			registrations, err := r.RegisterURLs(context.TODO(), []*Link{
+				{URL: "http://en.wikipedia.com"},
+				{URL: "http://en.wikipedia.com", ExpiresAt: testNow.Add(-time.Hour)},
+				{URL: "http://en.wikipedia.com", ExpiresAt: testNow.Add(time.Hour)},
+			})
+
+			m.AssertExpectations(t)
+			assert.NoError(t, err)
+			assert.Equal(t, []Registration{{Slug: "qwe"}, {Err: ErrInvalidExpiration}, {Slug: "asd"}}, registrations)
+			assert.Equal(t, int64(21), a.slugsCount)
+		})
+	})
+}
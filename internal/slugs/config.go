@@ -1,6 +1,29 @@
 package slugs
 
+import "time"
+
 type Config struct {
 	Salt      string `env:"SLUGS_SALT,required"`
 	MinLength int    `env:"SLUGS_MINLENGTH,default=30"`
+	BlockSize int64  `env:"SLUGS_BLOCKSIZE,default=1000"`
+	//TombstoneRetention is how long the expired links are answered with 410 after the expiry, zero keeps the
+	//tombstones forever
+	TombstoneRetention time.Duration `env:"SLUGS_TOMBSTONERETENTION,default=720h"`
+
+	Custom CustomConfig
+}
+
+type CustomConfig struct {
+	Charset   string   `env:"SLUGS_CUSTOM_CHARSET,default=abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_"`
+	MinLength int      `env:"SLUGS_CUSTOM_MINLENGTH,default=4"`
+	MaxLength int      `env:"SLUGS_CUSTOM_MAXLENGTH,default=64"`
+	Reserved  []string `env:"SLUGS_CUSTOM_RESERVED,default=api;internal;admin;debug;metrics;stats"`
+}
+
+//ShortestSlug is the length of the shortest slug which may be registered
+func (c *Config) ShortestSlug() int {
+	if c.Custom.MinLength < c.MinLength {
+		return c.Custom.MinLength
+	}
+	return c.MinLength
 }
@@ -0,0 +1,34 @@
+package slugs
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	ErrInvalidCustomSlug = errors.New("The custom slug is invalid")
+	ErrSlugIsTaken       = errors.New("The slug is already taken")
+)
+
+func customSlugKey(slug string) string {
+	return "custom:" + slug
+}
+
+//validateCustomSlug checks the slug against the config
+func validateCustomSlug(cfg *CustomConfig, slug string) error {
+	if len(slug) < cfg.MinLength || len(slug) > cfg.MaxLength {
+		return fmt.Errorf("%w: the length must be between %d and %d", ErrInvalidCustomSlug, cfg.MinLength, cfg.MaxLength)
+	}
+	for _, c := range slug {
+		if !strings.ContainsRune(cfg.Charset, c) {
+			return fmt.Errorf("%w: the character %q is not allowed", ErrInvalidCustomSlug, c)
+		}
+	}
+	for _, word := range cfg.Reserved {
+		if strings.EqualFold(slug, word) {
+			return fmt.Errorf("%w: %q is reserved", ErrInvalidCustomSlug, slug)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package slugs
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"sort"
+
+	"url-shortener/internal/logger"
+	"url-shortener/internal/storage"
+)
+
+//dedupeIdentity tells the links which may replace each other, so a link is never reused for another creator or
+//with another expiration, redirect code or tags
+type dedupeIdentity struct {
+	URL          string   `json:"url"`
+	Creator      string   `json:"creator,omitempty"`
+	ExpiresAt    int64    `json:"expires_at,omitempty"`
+	RedirectCode int      `json:"redirect_code,omitempty"`
+	Tags         []string `json:"tags,omitempty"`
+}
+
+//dedupeKey is the key of the reverse index, the identities are hashed to keep the keys short. The links without
+//the options are indexed by the URL alone, so the index built before the options were taken into account is kept.
+func dedupeKey(link *Link) string {
+	identity := dedupeIdentity{
+		URL:          link.URL,
+		Creator:      link.Creator,
+		RedirectCode: link.RedirectCode,
+	}
+	if !link.ExpiresAt.IsZero() {
+		identity.ExpiresAt = link.ExpiresAt.UnixNano()
+	}
+	if len(link.Tags) > 0 {
+		identity.Tags = append([]string(nil), link.Tags...)
+		sort.Strings(identity.Tags)
+	}
+
+	value := []byte(link.URL)
+	if identity.Creator != "" || identity.ExpiresAt != 0 || identity.RedirectCode != 0 || len(identity.Tags) > 0 {
+		// The marshaling of the strings and the numbers cannot fail
+		value, _ = json.Marshal(&identity)
+	}
+	sum := sha256.Sum256(value)
+	return "dedupe:" + hex.EncodeToString(sum[:])
+}
+
+//RegisterUniqueURL returns the slug of the link registered for the same URL by RegisterUniqueURL before. A new
+//link is registered only if there is no such link or it cannot be opened anymore, e.g. it has been disabled or
+//changed. The links registered by RegisterURL are never reused.
+func (r *registry) RegisterUniqueURL(ctx context.Context, link *Link) (string, error) {
+	key := dedupeKey(link)
+	slug, err := r.storage.LoadValue(ctx, key)
+	known := err == nil
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		logger.Ctx(ctx).Error().Err(err).Str("key", key).Msg("Cannot read the reverse index")
+		return "", err
+	}
+	if known {
+		reusable, err := r.isReusable(ctx, slug, key)
+		if err != nil {
+			return "", err
+		}
+		if reusable {
+			logger.Ctx(ctx).Debug().Str("slug", slug).Msg("The existing slug has been reused")
+			return slug, nil
+		}
+	}
+
+	expiration, err := r.expiration(link)
+	if err != nil {
+		return "", err
+	}
+	slug, err = r.RegisterURL(ctx, link)
+	if err != nil {
+		return "", err
+	}
+
+	if known {
+		err = r.storage.SaveValue(ctx, key, slug, expiration)
+	} else {
+		err = r.storage.CreateValue(ctx, key, slug, expiration)
+	}
+	if errors.Is(err, storage.ErrAlreadyExists) {
+		// The same URL has been registered concurrently, so the slug which got into the index first wins
+		if existing, err := r.storage.LoadValue(ctx, key); err == nil {
+			return existing, nil
+		}
+		return slug, nil
+	}
+	if err != nil {
+		// The link has been registered anyway, only the next registrations of the URL won't find it
+		logger.Ctx(ctx).Error().Err(err).Str("key", key).Str("slug", slug).Msg("Cannot update the reverse index")
+	}
+	return slug, nil
+}
+
+//isReusable reports whether the link still redirects to the same URL with the same options on behalf of the same
+//creator, the link may have been changed after it has been indexed
+func (r *registry) isReusable(ctx context.Context, slug string, key string) (bool, error) {
+	link, err := r.GetLink(ctx, slug)
+	switch {
+	case errors.Is(err, ErrNotFound), errors.Is(err, ErrExpired), errors.Is(err, ErrSlugIsCorrupted):
+		return false, nil
+	case err != nil:
+		return false, err
+	}
+	return !link.Disabled && dedupeKey(link) == key, nil
+}
@@ -0,0 +1,148 @@
+package slugs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"url-shortener/internal/storage"
+)
+
+func TestRegisterUniqueURL(t *testing.T) {
+	Convey("Test RegisterUniqueURL", t, func() {
+		m := &mock.Mock{}
+
+		r := registry{
+			custom:    testCustomConfig,
+			slugifier: &mockSlugifier{m: m},
+			now:       func() time.Time { return testNow },
+			storage:   &mockStorage{m: m},
+			allocator: &instanceAllocator{
+				instanceIndex: 5,
+				slugsCount:    19,
+			},
+		}
+		key := dedupeKey(&Link{URL: "http://en.wikipedia.com"})
+
+		Convey("It fails if the reverse index cannot be read", func() {
+			m.
+				On("LoadValue", mock.Anything, key).Return("", errors.New("loadValue error"))
+
+			_, err := r.RegisterUniqueURL(context.TODO(), &Link{URL: "http://en.wikipedia.com"})
+
+			m.AssertExpectations(t)
+			assert.EqualError(t, err, "loadValue error")
+		})
+
+		Convey("It reuses the existing link", func() {
+			m.
+				On("LoadValue", mock.Anything, key).Return("asd", nil).
+				On("DecodeSlug", "asd").Return(int64(1), int64(2), nil).
+				On("LoadValue", mock.Anything, "1:2").Return(testRecord, nil)
+
+			slug, err := r.RegisterUniqueURL(context.TODO(), &Link{URL: "http://en.wikipedia.com"})
+
+			m.AssertExpectations(t)
+			assert.NoError(t, err)
+			assert.Equal(t, "asd", slug)
+		})
+
+		Convey("It registers a new link and indexes it", func() {
+			m.
+				On("LoadValue", mock.Anything, key).Return("", storage.ErrNotFound).
+				On("NewSlug", int64(5), int64(19)).Return("qwe", nil).
+				On("SaveValue", mock.Anything, "5:19", testRecord, time.Duration(0)).Return(nil).
+				On("CreateValue", mock.Anything, key, "qwe", time.Duration(0)).Return(nil)
+
+			slug, err := r.RegisterUniqueURL(context.TODO(), &Link{URL: "http://en.wikipedia.com"})
+
+			m.AssertExpectations(t)
+			assert.NoError(t, err)
+			assert.Equal(t, "qwe", slug)
+		})
+
+		Convey("It replaces the link which cannot be opened anymore", func() {
+			m.
+				On("LoadValue", mock.Anything, key).Return("asd", nil).
+				On("DecodeSlug", "asd").Return(int64(1), int64(2), nil).
+				On("LoadValue", mock.Anything, "1:2").Return(testDisabledRecord, nil).
+				On("NewSlug", int64(5), int64(19)).Return("qwe", nil).
+				On("SaveValue", mock.Anything, "5:19", testRecord, time.Duration(0)).Return(nil).
+				On("SaveValue", mock.Anything, key, "qwe", time.Duration(0)).Return(nil)
+
+			slug, err := r.RegisterUniqueURL(context.TODO(), &Link{URL: "http://en.wikipedia.com"})
+
+			m.AssertExpectations(t)
+			assert.NoError(t, err)
+			assert.Equal(t, "qwe", slug)
+		})
+
+		Convey("It doesn't reuse the link changed after it has been indexed", func() {
+			m.
+				On("LoadValue", mock.Anything, key).Return("asd", nil).
+				On("DecodeSlug", "asd").Return(int64(1), int64(2), nil).
+				On("LoadValue", mock.Anything, "1:2").Return(testExpiringRecord, nil).
+				On("NewSlug", int64(5), int64(19)).Return("qwe", nil).
+				On("SaveValue", mock.Anything, "5:19", testRecord, time.Duration(0)).Return(nil).
+				On("SaveValue", mock.Anything, key, "qwe", time.Duration(0)).Return(nil)
+
+			slug, err := r.RegisterUniqueURL(context.TODO(), &Link{URL: "http://en.wikipedia.com"})
+
+			m.AssertExpectations(t)
+			assert.NoError(t, err)
+			assert.Equal(t, "qwe", slug)
+		})
+
+		Convey("It returns the slug indexed concurrently", func() {
+			m.
+				On("LoadValue", mock.Anything, key).Return("", storage.ErrNotFound).Once().
+				On("NewSlug", int64(5), int64(19)).Return("qwe", nil).
+				On("SaveValue", mock.Anything, "5:19", testRecord, time.Duration(0)).Return(nil).
+				On("CreateValue", mock.Anything, key, "qwe", time.Duration(0)).Return(storage.ErrAlreadyExists).
+				On("LoadValue", mock.Anything, key).Return("asd", nil).Once()
+
+			slug, err := r.RegisterUniqueURL(context.TODO(), &Link{URL: "http://en.wikipedia.com"})
+
+			m.AssertExpectations(t)
+			assert.NoError(t, err)
+			assert.Equal(t, "asd", slug)
+		})
+
+		Convey("It keeps the expiration of the link in the index", func() {
+			key := dedupeKey(&Link{URL: "http://en.wikipedia.com", ExpiresAt: testNow.Add(time.Hour)})
+			m.
+				On("LoadValue", mock.Anything, key).Return("", storage.ErrNotFound).
+				On("NewSlug", int64(5), int64(19)).Return("qwe", nil).
+				On("SaveValue", mock.Anything, "5:19", testExpiringRecord, time.Hour).Return(nil).
+				On("SaveValue", mock.Anything, "expired:{5:19}", "2020-03-15T11:30:00Z", time.Duration(0)).Return(nil).
+				On("CreateValue", mock.Anything, key, "qwe", time.Hour).Return(nil)
+
+			_, err := r.RegisterUniqueURL(context.TODO(), &Link{URL: "http://en.wikipedia.com", ExpiresAt: testNow.Add(time.Hour)})
+
+			m.AssertExpectations(t)
+			assert.NoError(t, err)
+		})
+
+		Convey("It indexes the links apart by the creator and the options", func() {
+			link := &Link{URL: "http://en.wikipedia.com", Creator: "alice", RedirectCode: 302, Tags: []string{"b", "a"}}
+			keys := map[string]bool{
+				key:             true,
+				dedupeKey(link): true,
+				dedupeKey(&Link{URL: link.URL, Creator: "bob", RedirectCode: 302, Tags: []string{"a", "b"}}):           true,
+				dedupeKey(&Link{URL: link.URL, Creator: "alice", Tags: []string{"a", "b"}}):                            true,
+				dedupeKey(&Link{URL: link.URL, Creator: "alice", RedirectCode: 302}):                                   true,
+				dedupeKey(&Link{URL: link.URL, Creator: "alice", RedirectCode: 302, ExpiresAt: testNow}):               true,
+				dedupeKey(&Link{URL: "http://en.wikipedia.org", Creator: "alice", RedirectCode: 302, Tags: link.Tags}): true,
+			}
+
+			assert.Len(t, keys, 7)
+			assert.Equal(t, dedupeKey(link), dedupeKey(&Link{URL: link.URL, Creator: "alice", RedirectCode: 302, Tags: []string{"a", "b"}}))
+			assert.Equal(t, []string{"b", "a"}, link.Tags)
+		})
+	})
+}
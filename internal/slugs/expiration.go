@@ -0,0 +1,53 @@
+package slugs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"url-shortener/internal/storage"
+)
+
+var (
+	ErrExpired           = errors.New("The short link has expired")
+	ErrInvalidExpiration = errors.New("The expiration time must be in the future")
+)
+
+//The braces keep the tombstone in the hash slot of the record
+func tombstoneKey(key string) string {
+	return fmt.Sprintf("expired:{%s}", key)
+}
+
+//expiration returns how long the record has to be kept, zero means forever
+func (r *registry) expiration(link *Link) (time.Duration, error) {
+	if link.ExpiresAt.IsZero() {
+		return 0, nil
+	}
+	expiration := link.ExpiresAt.Sub(r.now())
+	if expiration <= 0 {
+		return 0, ErrInvalidExpiration
+	}
+	return expiration, nil
+}
+
+//saveTombstone leaves a mark which outlives the record by the retention, so the expired links can be told from the
+//unknown ones until then
+func (r *registry) saveTombstone(ctx context.Context, key string, link *Link) error {
+	if link.ExpiresAt.IsZero() {
+		return nil
+	}
+	tombstone := r.tombstone(key, link)
+	return r.storage.SaveValue(ctx, tombstone.Key, tombstone.Value, tombstone.Expiration)
+}
+
+func (r *registry) tombstone(key string, link *Link) storage.Record {
+	record := storage.Record{
+		Key:   tombstoneKey(key),
+		Value: link.ExpiresAt.UTC().Format(time.RFC3339),
+	}
+	if r.tombstoneRetention > 0 {
+		record.Expiration = link.ExpiresAt.Add(r.tombstoneRetention).Sub(r.now())
+	}
+	return record
+}
@@ -0,0 +1,119 @@
+package slugs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const linkRecordVersion = 1
+
+var (
+	errUnsupportedRecord = errors.New("The record version is not supported")
+)
+
+const (
+	ActionUpdate  = "update"
+	ActionDisable = "disable"
+)
+
+type Link struct {
+	URL       string
+	CreatedAt time.Time
+	//UpdatedAt is zero if the link has never been changed
+	UpdatedAt time.Time
+	//ExpiresAt is zero if the link never expires
+	ExpiresAt time.Time
+	//RedirectCode is zero if the link uses the default one
+	RedirectCode int
+	Creator      string
+	Tags         []string
+	Disabled     bool
+	Changes      []Change
+}
+
+//Change keeps the values which were replaced by an update of the link
+type Change struct {
+	At                   time.Time `json:"at"`
+	Action               string    `json:"action"`
+	PreviousURL          string    `json:"previous_url,omitempty"`
+	PreviousRedirectCode int       `json:"previous_redirect_code,omitempty"`
+}
+
+//linkRecord is the way the links are kept in the storage
+type linkRecord struct {
+	Version      int        `json:"v"`
+	URL          string     `json:"url"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    *time.Time `json:"updated_at,omitempty"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+	RedirectCode int        `json:"redirect_code,omitempty"`
+	Creator      string     `json:"creator,omitempty"`
+	Tags         []string   `json:"tags,omitempty"`
+	Disabled     bool       `json:"disabled,omitempty"`
+	Changes      []Change   `json:"changes,omitempty"`
+}
+
+func encodeLink(link *Link) (string, error) {
+	record := linkRecord{
+		Version:      linkRecordVersion,
+		URL:          link.URL,
+		CreatedAt:    link.CreatedAt,
+		RedirectCode: link.RedirectCode,
+		Creator:      link.Creator,
+		Tags:         link.Tags,
+		Disabled:     link.Disabled,
+		Changes:      link.Changes,
+	}
+	if !link.UpdatedAt.IsZero() {
+		record.UpdatedAt = &link.UpdatedAt
+	}
+	if !link.ExpiresAt.IsZero() {
+		record.ExpiresAt = &link.ExpiresAt
+	}
+
+	b, err := json.Marshal(&record)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+//isLegacyRecord reports whether the value is a bare URL saved before the records were introduced, such a link
+//uses the default redirect code. A valid URL never starts with a brace.
+func isLegacyRecord(value string) bool {
+	return !strings.HasPrefix(value, "{")
+}
+
+func decodeLink(value string) (*Link, error) {
+	if isLegacyRecord(value) {
+		return &Link{URL: value}, nil
+	}
+
+	record := linkRecord{}
+	if err := json.Unmarshal([]byte(value), &record); err != nil {
+		return nil, err
+	}
+	if record.Version != linkRecordVersion {
+		return nil, fmt.Errorf("%w: %d", errUnsupportedRecord, record.Version)
+	}
+
+	link := &Link{
+		URL:          record.URL,
+		CreatedAt:    record.CreatedAt,
+		RedirectCode: record.RedirectCode,
+		Creator:      record.Creator,
+		Tags:         record.Tags,
+		Disabled:     record.Disabled,
+		Changes:      record.Changes,
+	}
+	if record.UpdatedAt != nil {
+		link.UpdatedAt = *record.UpdatedAt
+	}
+	if record.ExpiresAt != nil {
+		link.ExpiresAt = *record.ExpiresAt
+	}
+	return link, nil
+}
@@ -0,0 +1,27 @@
+package slugs
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	allocatedIndices = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "url_shortener",
+		Subsystem: "slugs",
+		Name:      "allocated_indices_total",
+		Help:      "The slug indices handed out by the allocator.",
+	}, []string{"allocator"})
+	leasedBlocks = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "url_shortener",
+		Subsystem: "slugs",
+		Name:      "leased_blocks_total",
+		Help:      "The blocks of slug indices leased from the storage, either reserved or reclaimed.",
+	}, []string{"source"})
+	releasedBlocks = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "url_shortener",
+		Subsystem: "slugs",
+		Name:      "released_blocks_total",
+		Help:      "The blocks of slug indices given back to the storage.",
+	})
+)
@@ -2,61 +2,175 @@ package slugs
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"time"
 
 	"url-shortener/internal/logger"
 	"url-shortener/internal/storage"
 )
 
+var (
+	ErrNotFound = errors.New("The short link is not found")
+)
+
 type slugifier interface {
 	NewSlug(instanceIndex int64, slugIndex int64) (string, error)
 	DecodeSlug(slug string) (instanceIndex int64, slugIndex int64, err error)
 }
 
 type registry struct {
-	slugifier     slugifier
-	storage       storage.Storage
-	instanceIndex int64
-	slugsCount    int64
+	custom    *CustomConfig
+	slugifier slugifier
+	storage   storage.Storage
+	allocator indexAllocator
+	now       func() time.Time
+
+	tombstoneRetention time.Duration
 }
 
-func (r *registry) RegisterURL(ctx context.Context, url string) (string, error) {
-	slug, err := r.slugifier.NewSlug(r.instanceIndex, r.slugsCount)
+//RegisterURL is safe for concurrent use. An index is taken even if the registration fails, so the concurrent
+//requests never share a key. The creation time of the link is set by the registry.
+func (r *registry) RegisterURL(ctx context.Context, link *Link) (string, error) {
+	expiration, err := r.expiration(link)
+	if err != nil {
+		return "", err
+	}
+
+	instanceIndex, slugIndex, err := r.allocator.NextIndex(ctx)
+	if err != nil {
+		logger.Ctx(ctx).Error().Err(err).Msg("Cannot allocate a slug index")
+		return "", err
+	}
+
+	slug, err := r.slugifier.NewSlug(instanceIndex, slugIndex)
 	if err != nil {
 		return "", err
 	}
 	logger.Ctx(ctx).Trace().Str("slug", slug).Msg("The new slug has been produced")
 
-	key := fmt.Sprintf("%d:%d", r.instanceIndex, r.slugsCount)
-	if err := r.storage.SaveValue(ctx, key, url); err != nil {
-		logger.Ctx(ctx).Error().Err(err).Str("key", key).Str("url", url).Msg("Cannot create a record")
+	link.CreatedAt = r.now().UTC()
+	value, err := encodeLink(link)
+	if err != nil {
+		return "", err
+	}
+
+	key := fmt.Sprintf("%d:%d", instanceIndex, slugIndex)
+	if err := r.storage.SaveValue(ctx, key, value, expiration); err != nil {
+		logger.Ctx(ctx).Error().Err(err).Str("key", key).Str("url", link.URL).Msg("Cannot create a record")
+		return "", err
+	}
+	if err := r.saveTombstone(ctx, key, link); err != nil {
+		logger.Ctx(ctx).Error().Err(err).Str("key", key).Msg("Cannot create a tombstone")
 		return "", err
 	}
 
-	r.slugsCount++
 	return slug, nil
 }
 
-func (r *registry) GetURL(ctx context.Context, slug string) (string, error) {
-	instanceIndex, slugIndex, err := r.slugifier.DecodeSlug(slug)
+//RegisterCustomURL registers the link under the slug chosen by the client. The slugs which can be decoded by
+//the slugifier are rejected, otherwise a custom slug could shadow a generated one.
+func (r *registry) RegisterCustomURL(ctx context.Context, slug string, link *Link) error {
+	if err := validateCustomSlug(r.custom, slug); err != nil {
+		return err
+	}
+	expiration, err := r.expiration(link)
 	if err != nil {
-		return "", err
+		return err
+	}
+	if _, _, err := r.slugifier.DecodeSlug(slug); err == nil {
+		return fmt.Errorf("%w: it looks like a generated slug", ErrInvalidCustomSlug)
 	}
 
-	key := fmt.Sprintf("%d:%d", instanceIndex, slugIndex)
-	url, err := r.storage.LoadValue(ctx, key)
+	link.CreatedAt = r.now().UTC()
+	value, err := encodeLink(link)
+	if err != nil {
+		return err
+	}
+
+	key := customSlugKey(slug)
+	err = r.storage.CreateValue(ctx, key, value, expiration)
+	if errors.Is(err, storage.ErrAlreadyExists) {
+		return ErrSlugIsTaken
+	}
+	if err != nil {
+		logger.Ctx(ctx).Error().Err(err).Str("key", key).Str("url", link.URL).Msg("Cannot create a record")
+		return err
+	}
+	if err := r.saveTombstone(ctx, key, link); err != nil {
+		logger.Ctx(ctx).Error().Err(err).Str("key", key).Msg("Cannot create a tombstone")
+		return err
+	}
+	return nil
+}
+
+func (r *registry) GetLink(ctx context.Context, slug string) (*Link, error) {
+	key, err := r.slugKey(slug)
+	if err != nil {
+		return nil, err
+	}
+
+	link, _, err := r.loadLink(ctx, key)
+	return link, err
+}
+
+//loadLink returns the link together with the record it has been decoded from
+func (r *registry) loadLink(ctx context.Context, key string) (*Link, string, error) {
+	value, err := r.storage.LoadValue(ctx, key)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, "", r.missingLinkError(ctx, key)
+	}
 	if err != nil {
 		logger.Ctx(ctx).Error().Err(err).Str("key", key).Msg("Cannot read a value")
-		return "", err
+		return nil, "", err
 	}
 
-	return url, nil
+	link, err := decodeLink(value)
+	if err != nil {
+		logger.Ctx(ctx).Error().Err(err).Str("key", key).Msg("Cannot decode a record")
+		return nil, "", err
+	}
+	//the cached records may outlive the expiration
+	if !link.ExpiresAt.IsZero() && !r.now().Before(link.ExpiresAt) {
+		return nil, "", ErrExpired
+	}
+
+	return link, value, nil
+}
+
+//missingLinkError tells the expired links from the unknown ones by their tombstones
+func (r *registry) missingLinkError(ctx context.Context, key string) error {
+	_, err := r.storage.LoadValue(ctx, tombstoneKey(key))
+	switch {
+	case err == nil:
+		return ErrExpired
+	case errors.Is(err, storage.ErrNotFound):
+		return ErrNotFound
+	}
+	logger.Ctx(ctx).Error().Err(err).Str("key", key).Msg("Cannot read a tombstone")
+	return err
 }
 
-func NewRegistry(slugifier slugifier, storage storage.Storage, instanceIndex int64) *registry {
+//slugKey returns the key of the record, the slugs which cannot be decoded are looked up among the custom ones
+func (r *registry) slugKey(slug string) (string, error) {
+	instanceIndex, slugIndex, err := r.slugifier.DecodeSlug(slug)
+	if err == nil {
+		return fmt.Sprintf("%d:%d", instanceIndex, slugIndex), nil
+	}
+	if validateCustomSlug(r.custom, slug) == nil {
+		return customSlugKey(slug), nil
+	}
+	return "", err
+}
+
+func NewRegistry(cfg *Config, slugifier slugifier, storage storage.Storage, allocator indexAllocator) *registry {
 	return &registry{
-		slugifier:     slugifier,
-		storage:       storage,
-		instanceIndex: instanceIndex,
+		custom:    &cfg.Custom,
+		slugifier: slugifier,
+		storage:   storage,
+		allocator: allocator,
+		now:       time.Now,
+
+		tombstoneRetention: cfg.TombstoneRetention,
 	}
 }
@@ -3,19 +3,39 @@ package slugs
 import (
 	"context"
 	"errors"
+	"fmt"
+	"sync"
 	"testing"
+	"time"
 
 	. "github.com/smartystreets/goconvey/convey"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+
+	"url-shortener/internal/storage"
 )
 
 type mockStorage struct {
 	m *mock.Mock
 }
 
-func (s *mockStorage) SaveValue(ctx context.Context, key string, value string) error {
-	args := s.m.Called(ctx, key, value)
+func (s *mockStorage) SaveValue(ctx context.Context, key string, value string, expiration time.Duration) error {
+	args := s.m.Called(ctx, key, value, expiration)
+	return args.Error(0)
+}
+
+func (s *mockStorage) SaveValues(ctx context.Context, records []storage.Record) error {
+	args := s.m.Called(ctx, records)
+	return args.Error(0)
+}
+
+func (s *mockStorage) CreateValue(ctx context.Context, key string, value string, expiration time.Duration) error {
+	args := s.m.Called(ctx, key, value, expiration)
+	return args.Error(0)
+}
+
+func (s *mockStorage) UpdateValue(ctx context.Context, key string, previous string, value string, expiration time.Duration) error {
+	args := s.m.Called(ctx, key, previous, value, expiration)
 	return args.Error(0)
 }
 
@@ -24,6 +44,20 @@ func (s *mockStorage) LoadValue(ctx context.Context, key string) (string, error)
 	return args.String(0), args.Error(1)
 }
 
+var testNow = time.Date(2020, 3, 15, 10, 30, 0, 0, time.UTC)
+
+const (
+	testRecord         = `{"v":1,"url":"http://en.wikipedia.com","created_at":"2020-03-15T10:30:00Z"}`
+	testExpiringRecord = `{"v":1,"url":"http://en.wikipedia.com","created_at":"2020-03-15T10:30:00Z","expires_at":"2020-03-15T11:30:00Z"}`
+)
+
+var testCustomConfig = &CustomConfig{
+	Charset:   "abcdefghijklmnopqrstuvwxyz-",
+	MinLength: 4,
+	MaxLength: 10,
+	Reserved:  []string{"internal"},
+}
+
 type mockSlugifier struct {
 	m *mock.Mock
 }
@@ -42,58 +76,120 @@ func TestRegisterURL(t *testing.T) {
 	Convey("Test RegisterURL", t, func() {
 		m := &mock.Mock{}
 
-		r := registry{
-			slugifier:     &mockSlugifier{m: m},
+		a := &instanceAllocator{
 			instanceIndex: 5,
 			slugsCount:    19,
-			storage:       &mockStorage{m: m},
 		}
+		r := registry{
+			custom:    testCustomConfig,
+			slugifier: &mockSlugifier{m: m},
+			now:       func() time.Time { return testNow },
+			storage:   &mockStorage{m: m},
+			allocator: a,
+		}
+
+		Convey("It fails if no index can be allocated", func() {
+			r.allocator = NewBlockAllocator(&Config{BlockSize: 10}, &mockBlockStorage{m: m})
+			m.
+				On("ReclaimBlock", mock.Anything).Return(int64(0), int64(0), errors.New("ReclaimBlock error"))
+
+			_, err := r.RegisterURL(context.TODO(), &Link{URL: "http://en.wikipedia.com"})
+
+			m.AssertExpectations(t)
+			assert.EqualError(t, err, "ReclaimBlock error")
+		})
 
 		Convey("It fails if the slugifier has failed", func() {
 			m.
 				On("NewSlug", int64(5), int64(19)).Return("", errors.New("NewSlug error"))
 
-			_, err := r.RegisterURL(nil, "")
+			_, err := r.RegisterURL(nil, &Link{URL: ""})
 
 			m.AssertExpectations(t)
 			assert.EqualError(t, err, "NewSlug error")
-			assert.Equal(t, int64(5), r.instanceIndex)
-			assert.Equal(t, int64(19), r.slugsCount)
+			assert.Equal(t, int64(5), a.instanceIndex)
+			assert.Equal(t, int64(20), a.slugsCount)
 		})
 
 		Convey("It fails if the value cannot be saved", func() {
 			m.
 				On("NewSlug", int64(5), int64(19)).Return("qwe", nil).
-				On("SaveValue", mock.Anything, "5:19", "http://en.wikipedia.com").Return(errors.New("saveValue error"))
+				On("SaveValue", mock.Anything, "5:19", testRecord, time.Duration(0)).Return(errors.New("saveValue error"))
+
+			_, err := r.RegisterURL(context.TODO(), &Link{URL: "http://en.wikipedia.com"})
+
+			m.AssertExpectations(t)
+			assert.EqualError(t, err, "saveValue error")
+			assert.Equal(t, int64(5), a.instanceIndex)
+			assert.Equal(t, int64(20), a.slugsCount)
+		})
+
+		Convey("It rejects the expiration in the past", func() {
+			_, err := r.RegisterURL(context.TODO(), &Link{URL: "http://en.wikipedia.com", ExpiresAt: testNow})
+
+			m.AssertExpectations(t)
+			assert.Equal(t, ErrInvalidExpiration, err)
+			assert.Equal(t, int64(19), a.slugsCount)
+		})
+
+		Convey("It saves the expiring links with tombstones", func() {
+			m.
+				On("NewSlug", int64(5), int64(19)).Return("qwe", nil).
+				On("SaveValue", mock.Anything, "5:19", testExpiringRecord, time.Hour).Return(nil).
+				On("SaveValue", mock.Anything, "expired:{5:19}", "2020-03-15T11:30:00Z", time.Duration(0)).Return(nil)
+
+			slug, err := r.RegisterURL(context.TODO(), &Link{URL: "http://en.wikipedia.com", ExpiresAt: testNow.Add(time.Hour)})
+
+			m.AssertExpectations(t)
+			assert.NoError(t, err)
+			assert.Equal(t, "qwe", slug)
+		})
+
+		Convey("It keeps the tombstones for the retention", func() {
+			r.tombstoneRetention = 24 * time.Hour
+			m.
+				On("NewSlug", int64(5), int64(19)).Return("qwe", nil).
+				On("SaveValue", mock.Anything, "5:19", testExpiringRecord, time.Hour).Return(nil).
+				On("SaveValue", mock.Anything, "expired:{5:19}", "2020-03-15T11:30:00Z", 25*time.Hour).Return(nil)
 
-			_, err := r.RegisterURL(context.TODO(), "http://en.wikipedia.com")
+			_, err := r.RegisterURL(context.TODO(), &Link{URL: "http://en.wikipedia.com", ExpiresAt: testNow.Add(time.Hour)})
+
+			m.AssertExpectations(t)
+			assert.NoError(t, err)
+		})
+
+		Convey("It fails if the tombstone cannot be saved", func() {
+			m.
+				On("NewSlug", int64(5), int64(19)).Return("qwe", nil).
+				On("SaveValue", mock.Anything, "5:19", testExpiringRecord, time.Hour).Return(nil).
+				On("SaveValue", mock.Anything, "expired:{5:19}", "2020-03-15T11:30:00Z", time.Duration(0)).Return(errors.New("saveValue error"))
+
+			_, err := r.RegisterURL(context.TODO(), &Link{URL: "http://en.wikipedia.com", ExpiresAt: testNow.Add(time.Hour)})
 
 			m.AssertExpectations(t)
 			assert.EqualError(t, err, "saveValue error")
-			assert.Equal(t, int64(5), r.instanceIndex)
-			assert.Equal(t, int64(19), r.slugsCount)
 		})
 
 		Convey("It returns a new slug", func() {
 			m.
 				On("NewSlug", int64(5), int64(19)).Return("qwe", nil).
-				On("SaveValue", mock.Anything, "5:19", "http://en.wikipedia.com").Return(nil).
+				On("SaveValue", mock.Anything, "5:19", testRecord, time.Duration(0)).Return(nil).
 				On("NewSlug", int64(5), int64(20)).Return("asd", nil).
-				On("SaveValue", mock.Anything, "5:20", "http://en.wikipedia.com").Return(nil)
+				On("SaveValue", mock.Anything, "5:20", testRecord, time.Duration(0)).Return(nil)
 
 			{
-				slug, err := r.RegisterURL(context.TODO(), "http://en.wikipedia.com")
+				slug, err := r.RegisterURL(context.TODO(), &Link{URL: "http://en.wikipedia.com"})
 				assert.NoError(t, err)
 				assert.Equal(t, "qwe", slug)
-				assert.Equal(t, int64(5), r.instanceIndex)
-				assert.Equal(t, int64(20), r.slugsCount)
+				assert.Equal(t, int64(5), a.instanceIndex)
+				assert.Equal(t, int64(20), a.slugsCount)
 			}
 			{
-				slug, err := r.RegisterURL(context.TODO(), "http://en.wikipedia.com")
+				slug, err := r.RegisterURL(context.TODO(), &Link{URL: "http://en.wikipedia.com"})
 				assert.NoError(t, err)
 				assert.Equal(t, "asd", slug)
-				assert.Equal(t, int64(5), r.instanceIndex)
-				assert.Equal(t, int64(21), r.slugsCount)
+				assert.Equal(t, int64(5), a.instanceIndex)
+				assert.Equal(t, int64(21), a.slugsCount)
 			}
 
 			m.AssertExpectations(t)
@@ -101,27 +197,190 @@ func TestRegisterURL(t *testing.T) {
 	})
 }
 
-func TestGetURL(t *testing.T) {
-	Convey("Test GetURL", t, func() {
+type syncStorage struct {
+	values sync.Map
+}
+
+func (s *syncStorage) SaveValue(ctx context.Context, key string, value string, expiration time.Duration) error {
+	if _, loaded := s.values.LoadOrStore(key, value); loaded {
+		return fmt.Errorf("The key %s is overwritten", key)
+	}
+	return nil
+}
+
+func (s *syncStorage) SaveValues(ctx context.Context, records []storage.Record) error {
+	for _, record := range records {
+		if err := s.SaveValue(ctx, record.Key, record.Value, record.Expiration); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *syncStorage) CreateValue(ctx context.Context, key string, value string, expiration time.Duration) error {
+	if _, loaded := s.values.LoadOrStore(key, value); loaded {
+		return storage.ErrAlreadyExists
+	}
+	return nil
+}
+
+func (s *syncStorage) UpdateValue(ctx context.Context, key string, previous string, value string, expiration time.Duration) error {
+	return errors.New("UpdateValue is not supported")
+}
+
+func (s *syncStorage) LoadValue(ctx context.Context, key string) (string, error) {
+	value, ok := s.values.Load(key)
+	if !ok {
+		return "", storage.ErrNotFound
+	}
+	return value.(string), nil
+}
+
+func TestRegisterURLConcurrently(t *testing.T) {
+	const requests = 5000
+
+	slugifier, err := NewHashidsSlugifier(&Config{Salt: "123", MinLength: 8})
+	assert.NoError(t, err)
+
+	allocators := map[string]indexAllocator{
+		"instance": NewInstanceAllocator(7),
+		"block":    NewBlockAllocator(&Config{BlockSize: 64}, &syncBlockStorage{}),
+	}
+	for name, allocator := range allocators {
+		t.Run(name, func(t *testing.T) {
+			r := NewRegistry(&Config{}, slugifier, &syncStorage{}, allocator)
+
+			slugs := make([]string, requests)
+			wg := sync.WaitGroup{}
+			for i := 0; i < requests; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					slug, err := r.RegisterURL(context.TODO(), &Link{URL: fmt.Sprintf("http://example.com/%d", i)})
+					assert.NoError(t, err)
+					slugs[i] = slug
+				}(i)
+			}
+			wg.Wait()
+
+			unique := map[string]bool{}
+			for i, slug := range slugs {
+				assert.False(t, unique[slug], "The slug %s is duplicated", slug)
+				unique[slug] = true
+
+				link, err := r.GetLink(context.TODO(), slug)
+				assert.NoError(t, err)
+				assert.Equal(t, fmt.Sprintf("http://example.com/%d", i), link.URL)
+			}
+		})
+	}
+}
+
+func TestRegisterCustomURL(t *testing.T) {
+	Convey("Test RegisterCustomURL", t, func() {
 		m := &mock.Mock{}
 
 		r := registry{
-			slugifier:     &mockSlugifier{m: m},
+			custom:    testCustomConfig,
+			slugifier: &mockSlugifier{m: m},
+			now:       func() time.Time { return testNow },
+			storage:   &mockStorage{m: m},
+		}
+
+		Convey("It rejects the slugs which don't fit the config", func() {
+			for _, slug := range []string{"abc", "abcdefghijk", "abc_def", "Internal"} {
+				err := r.RegisterCustomURL(context.TODO(), slug, &Link{URL: "http://en.wikipedia.com"})
+				assert.True(t, errors.Is(err, ErrInvalidCustomSlug), slug)
+			}
+
+			m.AssertExpectations(t)
+		})
+
+		Convey("It rejects the slugs which can be decoded", func() {
+			m.
+				On("DecodeSlug", "qwerty").Return(int64(1), int64(2), nil)
+
+			err := r.RegisterCustomURL(context.TODO(), "qwerty", &Link{URL: "http://en.wikipedia.com"})
+
+			m.AssertExpectations(t)
+			assert.EqualError(t, err, "The custom slug is invalid: it looks like a generated slug")
+		})
+
+		Convey("It fails if the slug is taken", func() {
+			m.
+				On("DecodeSlug", "qwerty").Return(int64(0), int64(0), ErrSlugIsCorrupted).
+				On("CreateValue", mock.Anything, "custom:qwerty", testRecord, time.Duration(0)).Return(storage.ErrAlreadyExists)
+
+			err := r.RegisterCustomURL(context.TODO(), "qwerty", &Link{URL: "http://en.wikipedia.com"})
+
+			m.AssertExpectations(t)
+			assert.Equal(t, ErrSlugIsTaken, err)
+		})
+
+		Convey("It fails if the value cannot be created", func() {
+			m.
+				On("DecodeSlug", "qwerty").Return(int64(0), int64(0), ErrSlugIsCorrupted).
+				On("CreateValue", mock.Anything, "custom:qwerty", testRecord, time.Duration(0)).Return(errors.New("createValue error"))
+
+			err := r.RegisterCustomURL(context.TODO(), "qwerty", &Link{URL: "http://en.wikipedia.com"})
+
+			m.AssertExpectations(t)
+			assert.EqualError(t, err, "createValue error")
+		})
+
+		Convey("It registers the expiring custom slug", func() {
+			m.
+				On("DecodeSlug", "my-link").Return(int64(0), int64(0), ErrSlugIsCorrupted).
+				On("CreateValue", mock.Anything, "custom:my-link", `{"v":1,"url":"http://en.wikipedia.com","created_at":"2020-03-15T10:30:00Z","expires_at":"2020-03-15T12:30:00Z"}`, 2*time.Hour).Return(nil).
+				On("SaveValue", mock.Anything, "expired:{custom:my-link}", "2020-03-15T12:30:00Z", time.Duration(0)).Return(nil)
+
+			err := r.RegisterCustomURL(context.TODO(), "my-link", &Link{URL: "http://en.wikipedia.com", ExpiresAt: testNow.Add(2 * time.Hour)})
+
+			m.AssertExpectations(t)
+			assert.NoError(t, err)
+		})
+
+		Convey("It registers the custom slug", func() {
+			m.
+				On("DecodeSlug", "my-link").Return(int64(0), int64(0), ErrSlugIsCorrupted).
+				On("CreateValue", mock.Anything, "custom:my-link", `{"v":1,"url":"http://en.wikipedia.com","created_at":"2020-03-15T10:30:00Z","redirect_code":307,"tags":["wiki"]}`, time.Duration(0)).Return(nil)
+
+			err := r.RegisterCustomURL(context.TODO(), "my-link", &Link{URL: "http://en.wikipedia.com", RedirectCode: 307, Tags: []string{"wiki"}})
+
+			m.AssertExpectations(t)
+			assert.NoError(t, err)
+
+			m.AssertExpectations(t)
+		})
+	})
+}
+
+func TestGetLink(t *testing.T) {
+	Convey("Test GetLink", t, func() {
+		m := &mock.Mock{}
+
+		a := &instanceAllocator{
 			instanceIndex: 5,
 			slugsCount:    19,
-			storage:       &mockStorage{m: m},
+		}
+		r := registry{
+			custom:    testCustomConfig,
+			slugifier: &mockSlugifier{m: m},
+			now:       func() time.Time { return testNow },
+			storage:   &mockStorage{m: m},
+			allocator: a,
 		}
 
 		Convey("It fails if the slugifier has failed", func() {
 			m.
 				On("DecodeSlug", "123").Return(int64(321), int64(432), errors.New("DecodeSlug error"))
 
-			_, err := r.GetURL(context.TODO(), "123")
+			_, err := r.GetLink(context.TODO(), "123")
 
 			m.AssertExpectations(t)
 			assert.EqualError(t, err, "DecodeSlug error")
-			assert.Equal(t, int64(5), r.instanceIndex)
-			assert.Equal(t, int64(19), r.slugsCount)
+			assert.Equal(t, int64(5), a.instanceIndex)
+			assert.Equal(t, int64(19), a.slugsCount)
 		})
 
 		Convey("It fails if the value cannot be loaded", func() {
@@ -129,26 +388,107 @@ func TestGetURL(t *testing.T) {
 				On("DecodeSlug", "123").Return(int64(321), int64(432), nil).
 				On("LoadValue", mock.Anything, "321:432").Return("", errors.New("loadValue error"))
 
-			_, err := r.GetURL(context.TODO(), "123")
+			_, err := r.GetLink(context.TODO(), "123")
+
+			m.AssertExpectations(t)
+			assert.EqualError(t, err, "loadValue error")
+			assert.Equal(t, int64(5), a.instanceIndex)
+			assert.Equal(t, int64(19), a.slugsCount)
+		})
+
+		Convey("It fails if the value doesn't exist", func() {
+			m.
+				On("DecodeSlug", "123").Return(int64(321), int64(432), nil).
+				On("LoadValue", mock.Anything, "321:432").Return("", storage.ErrNotFound).
+				On("LoadValue", mock.Anything, "expired:{321:432}").Return("", storage.ErrNotFound)
+
+			_, err := r.GetLink(context.TODO(), "123")
+
+			m.AssertExpectations(t)
+			assert.Equal(t, ErrNotFound, err)
+		})
+
+		Convey("It fails if the link has expired", func() {
+			m.
+				On("DecodeSlug", "123").Return(int64(321), int64(432), nil).
+				On("LoadValue", mock.Anything, "321:432").Return("", storage.ErrNotFound).
+				On("LoadValue", mock.Anything, "expired:{321:432}").Return("2020-03-15T10:30:00Z", nil)
+
+			_, err := r.GetLink(context.TODO(), "123")
+
+			m.AssertExpectations(t)
+			assert.Equal(t, ErrExpired, err)
+		})
+
+		Convey("It fails if the loaded link has expired", func() {
+			m.
+				On("DecodeSlug", "123").Return(int64(321), int64(432), nil).
+				On("LoadValue", mock.Anything, "321:432").Return(`{"v":1,"url":"http://uber.com","expires_at":"2020-03-15T10:30:00Z"}`, nil)
+
+			_, err := r.GetLink(context.TODO(), "123")
+
+			m.AssertExpectations(t)
+			assert.Equal(t, ErrExpired, err)
+		})
+
+		Convey("It fails if the tombstone cannot be loaded", func() {
+			m.
+				On("DecodeSlug", "123").Return(int64(321), int64(432), nil).
+				On("LoadValue", mock.Anything, "321:432").Return("", storage.ErrNotFound).
+				On("LoadValue", mock.Anything, "expired:{321:432}").Return("", errors.New("loadValue error"))
+
+			_, err := r.GetLink(context.TODO(), "123")
 
 			m.AssertExpectations(t)
 			assert.EqualError(t, err, "loadValue error")
-			assert.Equal(t, int64(5), r.instanceIndex)
-			assert.Equal(t, int64(19), r.slugsCount)
 		})
 
-		Convey("It returns the correct URL", func() {
+		Convey("It fails if the record cannot be decoded", func() {
+			m.
+				On("DecodeSlug", "123").Return(int64(321), int64(432), nil).
+				On("LoadValue", mock.Anything, "321:432").Return(`{"v":2,"url":"http://uber.com"}`, nil)
+
+			_, err := r.GetLink(context.TODO(), "123")
+
+			m.AssertExpectations(t)
+			assert.EqualError(t, err, "The record version is not supported: 2")
+		})
+
+		Convey("It returns the link", func() {
+			m.
+				On("DecodeSlug", "123").Return(int64(321), int64(432), nil).
+				On("LoadValue", mock.Anything, "321:432").Return(`{"v":1,"url":"http://uber.com","created_at":"2020-03-15T10:30:00Z","expires_at":"2020-03-16T10:30:00Z","redirect_code":302,"creator":"marketing","tags":["promo"],"disabled":true}`, nil)
+
+			link, err := r.GetLink(context.TODO(), "123")
+
+			m.AssertExpectations(t)
+			assert.NoError(t, err)
+			assert.Equal(t,
+				&Link{
+					URL:          "http://uber.com",
+					CreatedAt:    testNow,
+					ExpiresAt:    testNow.Add(24 * time.Hour),
+					RedirectCode: 302,
+					Creator:      "marketing",
+					Tags:         []string{"promo"},
+					Disabled:     true,
+				},
+				link,
+			)
+			assert.Equal(t, int64(5), a.instanceIndex)
+			assert.Equal(t, int64(19), a.slugsCount)
+		})
+
+		Convey("It reads the legacy records with the default redirect code", func() {
 			m.
 				On("DecodeSlug", "123").Return(int64(321), int64(432), nil).
 				On("LoadValue", mock.Anything, "321:432").Return("http://uber.com", nil)
 
-			url, err := r.GetURL(context.TODO(), "123")
+			link, err := r.GetLink(context.TODO(), "123")
 
 			m.AssertExpectations(t)
 			assert.NoError(t, err)
-			assert.Equal(t, "http://uber.com", url)
-			assert.Equal(t, int64(5), r.instanceIndex)
-			assert.Equal(t, int64(19), r.slugsCount)
+			assert.Equal(t, &Link{URL: "http://uber.com"}, link)
 		})
 	})
 }
@@ -156,12 +496,18 @@ func TestGetURL(t *testing.T) {
 func TestNewRegistry(t *testing.T) {
 	slugifier := &mockSlugifier{}
 	storage := &mockStorage{}
-	r := NewRegistry(slugifier, storage, 178)
+	allocator := &instanceAllocator{}
+	cfg := &Config{TombstoneRetention: time.Hour}
+	r := NewRegistry(cfg, slugifier, storage, allocator)
+	r.now = nil
 	assert.Equal(t,
 		&registry{
-			slugifier:     slugifier,
-			storage:       storage,
-			instanceIndex: 178,
+			custom:    &cfg.Custom,
+			slugifier: slugifier,
+			storage:   storage,
+			allocator: allocator,
+
+			tombstoneRetention: time.Hour,
 		},
 		r,
 	)
@@ -2,12 +2,13 @@ package slugs
 
 import (
 	"errors"
+	"fmt"
 
 	"github.com/speps/go-hashids"
 )
 
 var (
-	errSlugIsCorrupted = errors.New("The slug is corrupted")
+	ErrSlugIsCorrupted = errors.New("The slug is corrupted")
 )
 
 type hashidsSlugifier struct {
@@ -21,10 +22,10 @@ func (s *hashidsSlugifier) NewSlug(instanceIndex int64, slugIndex int64) (string
 func (s *hashidsSlugifier) DecodeSlug(slug string) (instanceIndex int64, slugIndex int64, err error) {
 	numbers, err := s.h.DecodeInt64WithError(slug)
 	if err != nil {
-		return 0, 0, err
+		return 0, 0, fmt.Errorf("%w: %v", ErrSlugIsCorrupted, err)
 	}
 	if len(numbers) != 2 {
-		return 0, 0, errSlugIsCorrupted
+		return 0, 0, ErrSlugIsCorrupted
 	}
 	return numbers[0], numbers[1], nil
 }
@@ -1,6 +1,7 @@
 package slugs
 
 import (
+	"errors"
 	"testing"
 
 	. "github.com/smartystreets/goconvey/convey"
@@ -8,6 +9,11 @@ import (
 	"github.com/stretchr/testify/assert"
 )
 
+func TestShortestSlug(t *testing.T) {
+	assert.Equal(t, 4, (&Config{MinLength: 30, Custom: CustomConfig{MinLength: 4}}).ShortestSlug())
+	assert.Equal(t, 8, (&Config{MinLength: 8, Custom: CustomConfig{MinLength: 10}}).ShortestSlug())
+}
+
 func TestHashidsSlugifier(t *testing.T) {
 	Convey("Test HashidsSlugifier", t, func() {
 		Convey("It is constractable", func() {
@@ -18,7 +24,7 @@ func TestHashidsSlugifier(t *testing.T) {
 		})
 
 		Convey("It returns decodable slug", func() {
-			s, err := NewHashidsSlugifier(&Config{"123", 8})
+			s, err := NewHashidsSlugifier(&Config{Salt: "123", MinLength: 8})
 			assert.NoError(t, err)
 			slug, err := s.NewSlug(123, 456)
 			assert.NoError(t, err)
@@ -30,19 +36,20 @@ func TestHashidsSlugifier(t *testing.T) {
 		})
 
 		Convey("Creating of a new slug fails if hashids has failed", func() {
-			s, err := NewHashidsSlugifier(&Config{"123", 8})
+			s, err := NewHashidsSlugifier(&Config{Salt: "123", MinLength: 8})
 			assert.NoError(t, err)
 			_, err = s.NewSlug(123, -456)
 			assert.EqualError(t, err, "negative number not supported")
 		})
 
 		Convey("Test decoding", func() {
-			s, err := NewHashidsSlugifier(&Config{"123", 8})
+			s, err := NewHashidsSlugifier(&Config{Salt: "123", MinLength: 8})
 			assert.NoError(t, err)
 
 			Convey("It fails if decoding has failed", func() {
 				_, _, err := s.DecodeSlug("123")
-				assert.EqualError(t, err, "mismatch between encode and decode: 123 start 4rlRNlnd re-encoded. result: [0]")
+				assert.True(t, errors.Is(err, ErrSlugIsCorrupted))
+				assert.EqualError(t, err, "The slug is corrupted: mismatch between encode and decode: 123 start 4rlRNlnd re-encoded. result: [0]")
 			})
 
 			Convey("The count of the numbers must be equal to 2", func() {
@@ -54,7 +61,7 @@ func TestHashidsSlugifier(t *testing.T) {
 				slug, err := h.EncodeInt64([]int64{123, 456, 789})
 				assert.NoError(t, err)
 				_, _, err = s.DecodeSlug(slug)
-				assert.EqualError(t, err, "The slug is corrupted")
+				assert.Equal(t, ErrSlugIsCorrupted, err)
 			})
 		})
 	})
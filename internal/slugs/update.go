@@ -0,0 +1,103 @@
+package slugs
+
+import (
+	"context"
+	"errors"
+
+	"url-shortener/internal/logger"
+	"url-shortener/internal/storage"
+)
+
+//The concurrent changes of a link are rare, so a few attempts are enough to apply a change
+const updateAttempts = 3
+
+var (
+	ErrDisabled = errors.New("The short link has been disabled")
+	ErrConflict = errors.New("The short link is being changed concurrently")
+)
+
+//LinkUpdate keeps the new values of the link, the nil ones aren't changed
+type LinkUpdate struct {
+	URL          *string
+	RedirectCode *int
+}
+
+func (r *registry) UpdateLink(ctx context.Context, slug string, update *LinkUpdate) (*Link, error) {
+	return r.changeLink(ctx, slug, ActionUpdate, func(link *Link) error {
+		if link.Disabled {
+			return ErrDisabled
+		}
+		if update.URL != nil {
+			link.URL = *update.URL
+		}
+		if update.RedirectCode != nil {
+			link.RedirectCode = *update.RedirectCode
+		}
+		return nil
+	})
+}
+
+//DisableLink keeps the record, so the disabled link is answered differently from the unknown one
+func (r *registry) DisableLink(ctx context.Context, slug string) error {
+	_, err := r.changeLink(ctx, slug, ActionDisable, func(link *Link) error {
+		link.Disabled = true
+		return nil
+	})
+	return err
+}
+
+//changeLink applies the change to the current record and saves it only if nobody has changed it meanwhile, so
+//none of the changes is lost from the history
+func (r *registry) changeLink(ctx context.Context, slug string, action string, change func(link *Link) error) (*Link, error) {
+	key, err := r.slugKey(slug)
+	if err != nil {
+		return nil, err
+	}
+
+	for attempt := 0; attempt < updateAttempts; attempt++ {
+		link, previous, err := r.loadLink(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+
+		now := r.now().UTC()
+		entry := Change{
+			At:                   now,
+			Action:               action,
+			PreviousURL:          link.URL,
+			PreviousRedirectCode: link.RedirectCode,
+		}
+		if err := change(link); err != nil {
+			return nil, err
+		}
+		link.UpdatedAt = now
+		link.Changes = append(link.Changes, entry)
+
+		expiration, err := r.expiration(link)
+		if errors.Is(err, ErrInvalidExpiration) {
+			return nil, ErrExpired
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := encodeLink(link)
+		if err != nil {
+			return nil, err
+		}
+
+		err = r.storage.UpdateValue(ctx, key, previous, value, expiration)
+		switch {
+		case err == nil:
+			logger.Ctx(ctx).Info().Str("key", key).Str("action", action).Msg("The link has been changed")
+			return link, nil
+		case errors.Is(err, storage.ErrNotFound):
+			return nil, r.missingLinkError(ctx, key)
+		case !errors.Is(err, storage.ErrValueChanged):
+			logger.Ctx(ctx).Error().Err(err).Str("key", key).Msg("Cannot update a record")
+			return nil, err
+		}
+		logger.Ctx(ctx).Debug().Str("key", key).Int("attempt", attempt).Msg("The record has been changed concurrently")
+	}
+	return nil, ErrConflict
+}
@@ -0,0 +1,176 @@
+package slugs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"url-shortener/internal/storage"
+)
+
+const (
+	testUpdatedRecord  = `{"v":1,"url":"http://ru.wikipedia.com","created_at":"2020-03-15T10:30:00Z","updated_at":"2020-03-15T10:30:00Z","redirect_code":307,"changes":[{"at":"2020-03-15T10:30:00Z","action":"update","previous_url":"http://en.wikipedia.com"}]}`
+	testDisabledRecord = `{"v":1,"url":"http://en.wikipedia.com","created_at":"2020-03-15T10:30:00Z","updated_at":"2020-03-15T10:30:00Z","disabled":true,"changes":[{"at":"2020-03-15T10:30:00Z","action":"disable","previous_url":"http://en.wikipedia.com"}]}`
+)
+
+func TestUpdateLink(t *testing.T) {
+	Convey("Test UpdateLink", t, func() {
+		m := &mock.Mock{}
+
+		r := registry{
+			custom:    testCustomConfig,
+			slugifier: &mockSlugifier{m: m},
+			now:       func() time.Time { return testNow },
+			storage:   &mockStorage{m: m},
+		}
+		url := "http://ru.wikipedia.com"
+		redirectCode := 307
+		update := &LinkUpdate{URL: &url, RedirectCode: &redirectCode}
+
+		Convey("It fails if the slugifier has failed", func() {
+			m.
+				On("DecodeSlug", "123").Return(int64(0), int64(0), errors.New("DecodeSlug error"))
+
+			_, err := r.UpdateLink(context.TODO(), "123", update)
+
+			m.AssertExpectations(t)
+			assert.EqualError(t, err, "DecodeSlug error")
+		})
+
+		Convey("It fails if the link is not found", func() {
+			m.
+				On("DecodeSlug", "qwe").Return(int64(321), int64(432), nil).
+				On("LoadValue", mock.Anything, "321:432").Return("", storage.ErrNotFound).
+				On("LoadValue", mock.Anything, "expired:{321:432}").Return("", storage.ErrNotFound)
+
+			_, err := r.UpdateLink(context.TODO(), "qwe", update)
+
+			m.AssertExpectations(t)
+			assert.Equal(t, ErrNotFound, err)
+		})
+
+		Convey("It rejects the disabled link", func() {
+			m.
+				On("DecodeSlug", "qwe").Return(int64(321), int64(432), nil).
+				On("LoadValue", mock.Anything, "321:432").Return(testDisabledRecord, nil)
+
+			_, err := r.UpdateLink(context.TODO(), "qwe", update)
+
+			m.AssertExpectations(t)
+			assert.Equal(t, ErrDisabled, err)
+		})
+
+		Convey("It saves the change together with the previous values", func() {
+			m.
+				On("DecodeSlug", "qwe").Return(int64(321), int64(432), nil).
+				On("LoadValue", mock.Anything, "321:432").Return(testRecord, nil).
+				On("UpdateValue", mock.Anything, "321:432", testRecord, testUpdatedRecord, time.Duration(0)).Return(nil)
+
+			link, err := r.UpdateLink(context.TODO(), "qwe", update)
+
+			m.AssertExpectations(t)
+			assert.NoError(t, err)
+			assert.Equal(t, &Link{
+				URL:          "http://ru.wikipedia.com",
+				CreatedAt:    testNow,
+				UpdatedAt:    testNow,
+				RedirectCode: 307,
+				Changes: []Change{
+					{At: testNow, Action: ActionUpdate, PreviousURL: "http://en.wikipedia.com"},
+				},
+			}, link)
+		})
+
+		Convey("It retries if the record has been changed concurrently", func() {
+			m.
+				On("DecodeSlug", "qwe").Return(int64(321), int64(432), nil).
+				On("LoadValue", mock.Anything, "321:432").Return(testRecord, nil).
+				On("UpdateValue", mock.Anything, "321:432", testRecord, testUpdatedRecord, time.Duration(0)).Return(storage.ErrValueChanged).Once().
+				On("UpdateValue", mock.Anything, "321:432", testRecord, testUpdatedRecord, time.Duration(0)).Return(nil).Once()
+
+			_, err := r.UpdateLink(context.TODO(), "qwe", update)
+
+			m.AssertExpectations(t)
+			assert.NoError(t, err)
+		})
+
+		Convey("It gives up if the record keeps changing", func() {
+			m.
+				On("DecodeSlug", "qwe").Return(int64(321), int64(432), nil).
+				On("LoadValue", mock.Anything, "321:432").Return(testRecord, nil).
+				On("UpdateValue", mock.Anything, "321:432", testRecord, testUpdatedRecord, time.Duration(0)).Return(storage.ErrValueChanged).Times(updateAttempts)
+
+			_, err := r.UpdateLink(context.TODO(), "qwe", update)
+
+			m.AssertExpectations(t)
+			assert.Equal(t, ErrConflict, err)
+		})
+
+		Convey("It reports the link which expired during the update", func() {
+			m.
+				On("DecodeSlug", "qwe").Return(int64(321), int64(432), nil).
+				On("LoadValue", mock.Anything, "321:432").Return(testRecord, nil).
+				On("UpdateValue", mock.Anything, "321:432", testRecord, testUpdatedRecord, time.Duration(0)).Return(storage.ErrNotFound).
+				On("LoadValue", mock.Anything, "expired:{321:432}").Return("2020-03-15T10:30:00Z", nil)
+
+			_, err := r.UpdateLink(context.TODO(), "qwe", update)
+
+			m.AssertExpectations(t)
+			assert.Equal(t, ErrExpired, err)
+		})
+
+		Convey("It fails if the value cannot be updated", func() {
+			m.
+				On("DecodeSlug", "qwe").Return(int64(321), int64(432), nil).
+				On("LoadValue", mock.Anything, "321:432").Return(testRecord, nil).
+				On("UpdateValue", mock.Anything, "321:432", testRecord, testUpdatedRecord, time.Duration(0)).Return(errors.New("updateValue error"))
+
+			_, err := r.UpdateLink(context.TODO(), "qwe", update)
+
+			m.AssertExpectations(t)
+			assert.EqualError(t, err, "updateValue error")
+		})
+	})
+}
+
+func TestDisableLink(t *testing.T) {
+	Convey("Test DisableLink", t, func() {
+		m := &mock.Mock{}
+
+		r := registry{
+			custom:    testCustomConfig,
+			slugifier: &mockSlugifier{m: m},
+			now:       func() time.Time { return testNow },
+			storage:   &mockStorage{m: m},
+		}
+
+		Convey("It marks the link as disabled", func() {
+			m.
+				On("DecodeSlug", "qwe").Return(int64(321), int64(432), nil).
+				On("LoadValue", mock.Anything, "321:432").Return(testRecord, nil).
+				On("UpdateValue", mock.Anything, "321:432", testRecord, testDisabledRecord, time.Duration(0)).Return(nil)
+
+			err := r.DisableLink(context.TODO(), "qwe")
+
+			m.AssertExpectations(t)
+			assert.NoError(t, err)
+		})
+
+		Convey("It fails if the link is not found", func() {
+			m.
+				On("DecodeSlug", "qwe").Return(int64(321), int64(432), nil).
+				On("LoadValue", mock.Anything, "321:432").Return("", storage.ErrNotFound).
+				On("LoadValue", mock.Anything, "expired:{321:432}").Return("", storage.ErrNotFound)
+
+			err := r.DisableLink(context.TODO(), "qwe")
+
+			m.AssertExpectations(t)
+			assert.Equal(t, ErrNotFound, err)
+		})
+	})
+}
@@ -0,0 +1,72 @@
+package bolt
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	bbolt "go.etcd.io/bbolt"
+)
+
+const (
+	hitsBucketSize = time.Hour
+	hitsRetention  = 8 * 24 * time.Hour
+)
+
+func hitsTotalKey(slug string) []byte {
+	return []byte(fmt.Sprintf("%s:total", slug))
+}
+
+func hitsBucketKey(slug string, bucket time.Time) []byte {
+	return []byte(fmt.Sprintf("%s:%d", slug, bucket.Unix()))
+}
+
+//hitsBucketTime returns the start of the hourly bucket, the total counters aren't buckets
+func hitsBucketTime(key []byte) (time.Time, bool) {
+	k := string(key)
+	timestamp, err := strconv.ParseInt(k[strings.LastIndexByte(k, ':')+1:], 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(timestamp, 0), true
+}
+
+func (s *storage) SaveHit(ctx context.Context, slug string, at time.Time) error {
+	return wrapError(s.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(hitsBucket)
+		if _, err := increment(b, hitsTotalKey(slug), 1); err != nil {
+			return err
+		}
+		_, err := increment(b, hitsBucketKey(slug, at.Truncate(hitsBucketSize)), 1)
+		return err
+	}))
+}
+
+//LoadHits sums up the hourly buckets which start within the given interval
+func (s *storage) LoadHits(ctx context.Context, slug string, from time.Time, to time.Time) (int64, error) {
+	first := from.Truncate(hitsBucketSize)
+	if first.Before(from) {
+		first = first.Add(hitsBucketSize)
+	}
+
+	var hits int64
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(hitsBucket)
+		for bucket := first; !bucket.After(to); bucket = bucket.Add(hitsBucketSize) {
+			hits += counter(b, hitsBucketKey(slug, bucket))
+		}
+		return nil
+	})
+	return hits, wrapError(err)
+}
+
+func (s *storage) LoadTotalHits(ctx context.Context, slug string) (int64, error) {
+	var hits int64
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		hits = counter(tx.Bucket(hitsBucket), hitsTotalKey(slug))
+		return nil
+	})
+	return hits, wrapError(err)
+}
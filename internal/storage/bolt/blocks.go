@@ -0,0 +1,56 @@
+package bolt
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+
+	bbolt "go.etcd.io/bbolt"
+
+	basestorage "url-shortener/internal/storage"
+)
+
+func (s *storage) ReserveBlock(ctx context.Context, size int64) (int64, error) {
+	var end int64
+	err := s.db.Update(func(tx *bbolt.Tx) (err error) {
+		end, err = increment(tx.Bucket(countersBucket), slugIndexKey, size)
+		return err
+	})
+	if err != nil {
+		return 0, wrapError(err)
+	}
+	return end - size, nil
+}
+
+//ReleaseBlock queues the block under the next sequence number, so the blocks are reclaimed in order
+func (s *storage) ReleaseBlock(ctx context.Context, start int64, end int64) error {
+	return wrapError(s.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(freeBlocksBucket)
+		sequence, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		key := make([]byte, 8)
+		binary.BigEndian.PutUint64(key, sequence)
+		return b.Put(key, []byte(fmt.Sprintf("%d:%d", start, end)))
+	}))
+}
+
+func (s *storage) ReclaimBlock(ctx context.Context) (int64, int64, error) {
+	var start, end int64
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		c := tx.Bucket(freeBlocksBucket).Cursor()
+		key, block := c.First()
+		if key == nil {
+			return basestorage.ErrNotFound
+		}
+		if _, err := fmt.Sscanf(string(block), "%d:%d", &start, &end); err != nil {
+			return err
+		}
+		return c.Delete()
+	})
+	if err != nil {
+		return 0, 0, wrapError(err)
+	}
+	return start, end, nil
+}
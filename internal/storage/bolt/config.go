@@ -0,0 +1,11 @@
+package bolt
+
+import "time"
+
+type Config struct {
+	Path string `env:"BOLT_PATH,default=url-shortener.db"`
+	//LockTimeout limits waiting for the file which is opened by another process
+	LockTimeout time.Duration `env:"BOLT_LOCKTIMEOUT,default=1s"`
+	//SweepInterval is how often the expired values are removed, zero removes them only when the file is opened
+	SweepInterval time.Duration `env:"BOLT_SWEEPINTERVAL,default=1h"`
+}
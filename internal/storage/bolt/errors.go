@@ -0,0 +1,22 @@
+package bolt
+
+import (
+	"errors"
+	"fmt"
+
+	basestorage "url-shortener/internal/storage"
+)
+
+//wrapError keeps the storage errors and turns the failures of the database into the storage ones, so the
+//callers don't depend on the driver
+func wrapError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, basestorage.ErrNotFound),
+		errors.Is(err, basestorage.ErrAlreadyExists),
+		errors.Is(err, basestorage.ErrValueChanged):
+		return err
+	}
+	return fmt.Errorf("%w: %v", basestorage.ErrUnavailable, err)
+}
@@ -0,0 +1,225 @@
+package bolt
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	bbolt "go.etcd.io/bbolt"
+
+	"url-shortener/internal/logger/log"
+	basestorage "url-shortener/internal/storage"
+)
+
+var (
+	valuesBucket     = []byte("values")
+	countersBucket   = []byte("counters")
+	freeBlocksBucket = []byte("free_blocks")
+	hitsBucket       = []byte("hits")
+
+	instanceIndexKey = []byte("instance_index")
+	slugIndexKey     = []byte("slug_index")
+)
+
+//storage keeps everything in a single file, so the small deployments don't need Redis. Only one process may
+//open the file at a time.
+type storage struct {
+	db   *bbolt.DB
+	now  func() time.Time
+	quit chan struct{}
+	done chan struct{}
+}
+
+func (s *storage) Close() error {
+	close(s.quit)
+	<-s.done
+	return s.db.Close()
+}
+
+//Ping fails only if the file has been closed
+func (s *storage) Ping(ctx context.Context) error {
+	return wrapError(s.db.View(func(tx *bbolt.Tx) error {
+		return nil
+	}))
+}
+
+func (s *storage) NextInstanceIndex() (int64, error) {
+	var index int64
+	err := s.db.Update(func(tx *bbolt.Tx) (err error) {
+		index, err = increment(tx.Bucket(countersBucket), instanceIndexKey, 1)
+		return err
+	})
+	return index, wrapError(err)
+}
+
+func (s *storage) SaveValue(ctx context.Context, key string, value string, expiration time.Duration) error {
+	return wrapError(s.db.Update(func(tx *bbolt.Tx) error {
+		return s.put(tx, key, value, expiration)
+	}))
+}
+
+func (s *storage) SaveValues(ctx context.Context, records []basestorage.Record) error {
+	return wrapError(s.db.Update(func(tx *bbolt.Tx) error {
+		for _, record := range records {
+			if err := s.put(tx, record.Key, record.Value, record.Expiration); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+}
+
+func (s *storage) CreateValue(ctx context.Context, key string, value string, expiration time.Duration) error {
+	return wrapError(s.db.Update(func(tx *bbolt.Tx) error {
+		if _, ok := s.get(tx, key); ok {
+			return basestorage.ErrAlreadyExists
+		}
+		return s.put(tx, key, value, expiration)
+	}))
+}
+
+func (s *storage) UpdateValue(ctx context.Context, key string, previous string, value string, expiration time.Duration) error {
+	return wrapError(s.db.Update(func(tx *bbolt.Tx) error {
+		current, ok := s.get(tx, key)
+		if !ok {
+			return basestorage.ErrNotFound
+		}
+		if current != previous {
+			return basestorage.ErrValueChanged
+		}
+		return s.put(tx, key, value, expiration)
+	}))
+}
+
+func (s *storage) LoadValue(ctx context.Context, key string) (string, error) {
+	var value string
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		var ok bool
+		if value, ok = s.get(tx, key); !ok {
+			return basestorage.ErrNotFound
+		}
+		return nil
+	})
+	return value, wrapError(err)
+}
+
+//put keeps the expiration time in front of the value, zero means forever
+func (s *storage) put(tx *bbolt.Tx, key string, value string, expiration time.Duration) error {
+	var expiresAt int64
+	if expiration > 0 {
+		expiresAt = s.now().Add(expiration).UnixNano()
+	}
+	data := make([]byte, 8+len(value))
+	binary.BigEndian.PutUint64(data, uint64(expiresAt))
+	copy(data[8:], value)
+	return tx.Bucket(valuesBucket).Put([]byte(key), data)
+}
+
+//get ignores the expired values, they are removed by the periodic sweep and when the file is opened
+func (s *storage) get(tx *bbolt.Tx, key string) (string, bool) {
+	data := tx.Bucket(valuesBucket).Get([]byte(key))
+	if data == nil || s.isExpired(data) {
+		return "", false
+	}
+	return string(data[8:]), true
+}
+
+func (s *storage) isExpired(data []byte) bool {
+	expiresAt := int64(binary.BigEndian.Uint64(data))
+	return expiresAt != 0 && s.now().UnixNano() >= expiresAt
+}
+
+//removeExpired drops the expired values and the hits which are out of the retention
+func (s *storage) removeExpired() error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		values := tx.Bucket(valuesBucket).Cursor()
+		for key, data := values.First(); key != nil; key, data = values.Next() {
+			if s.isExpired(data) {
+				if err := values.Delete(); err != nil {
+					return err
+				}
+			}
+		}
+
+		hits := tx.Bucket(hitsBucket).Cursor()
+		for key, _ := hits.First(); key != nil; key, _ = hits.Next() {
+			if bucket, ok := hitsBucketTime(key); ok && s.now().Sub(bucket) > hitsRetention {
+				if err := hits.Delete(); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+//sweep removes the expired values until the storage is closed, so the file of a long-running process doesn't
+//grow without bound
+func (s *storage) sweep(interval time.Duration) {
+	defer close(s.done)
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.removeExpired(); err != nil {
+				log.Logger.Error().Err(err).Msg("Cannot remove the expired values")
+			}
+		case <-s.quit:
+			return
+		}
+	}
+}
+
+//increment adds the delta to the counter and returns the new value
+func increment(b *bbolt.Bucket, key []byte, delta int64) (int64, error) {
+	value := counter(b, key) + delta
+
+	data := make([]byte, 8)
+	binary.BigEndian.PutUint64(data, uint64(value))
+	return value, b.Put(key, data)
+}
+
+func counter(b *bbolt.Bucket, key []byte) int64 {
+	data := b.Get(key)
+	if data == nil {
+		return 0
+	}
+	return int64(binary.BigEndian.Uint64(data))
+}
+
+func NewStorage(cfg *Config) (*storage, error) {
+	db, err := bbolt.Open(cfg.Path, 0600, &bbolt.Options{Timeout: cfg.LockTimeout})
+	if err != nil {
+		return nil, fmt.Errorf("Cannot open %s: %w", cfg.Path, err)
+	}
+
+	s := &storage{
+		db:   db,
+		now:  time.Now,
+		quit: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	err = db.Update(func(tx *bbolt.Tx) error {
+		for _, name := range [][]byte{valuesBucket, countersBucket, freeBlocksBucket, hitsBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err == nil {
+		err = s.removeExpired()
+	}
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	go s.sweep(cfg.SweepInterval)
+	return s, nil
+}
@@ -0,0 +1,99 @@
+package bolt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bbolt "go.etcd.io/bbolt"
+
+	basestorage "url-shortener/internal/storage"
+	"url-shortener/internal/storage/conformance"
+)
+
+func TestStorage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bolt")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	opened := []*storage{}
+	defer func() {
+		for _, s := range opened {
+			s.Close()
+		}
+	}()
+
+	conformance.Run(t, func() (conformance.Backend, func(time.Duration)) {
+		s, err := NewStorage(&Config{Path: filepath.Join(dir, fmt.Sprintf("%d.db", len(opened))), LockTimeout: time.Second})
+		require.NoError(t, err)
+		opened = append(opened, s)
+
+		now := time.Now()
+		s.now = func() time.Time { return now }
+		return s, func(d time.Duration) { now = now.Add(d) }
+	})
+}
+
+func TestReopen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bolt")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	cfg := &Config{Path: filepath.Join(dir, "url-shortener.db"), LockTimeout: time.Second}
+	ctx := context.Background()
+
+	s, err := NewStorage(cfg)
+	require.NoError(t, err)
+	assert.NoError(t, s.SaveValue(ctx, "permanent", "value", 0))
+	assert.NoError(t, s.SaveValue(ctx, "expiring", "value", time.Millisecond))
+	_, err = s.NextInstanceIndex()
+	assert.NoError(t, err)
+	assert.NoError(t, s.Close())
+
+	time.Sleep(5 * time.Millisecond)
+	s, err = NewStorage(cfg)
+	require.NoError(t, err)
+	defer s.Close()
+
+	value, err := s.LoadValue(ctx, "permanent")
+	assert.NoError(t, err)
+	assert.Equal(t, "value", value)
+	_, err = s.LoadValue(ctx, "expiring")
+	assert.True(t, errors.Is(err, basestorage.ErrNotFound))
+	index, err := s.NextInstanceIndex()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), index)
+
+	_, err = NewStorage(&Config{Path: cfg.Path, LockTimeout: 10 * time.Millisecond})
+	assert.Error(t, err)
+}
+
+func TestSweep(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bolt")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	ctx := context.Background()
+
+	s, err := NewStorage(&Config{Path: filepath.Join(dir, "url-shortener.db"), LockTimeout: time.Second, SweepInterval: 5 * time.Millisecond})
+	require.NoError(t, err)
+	defer s.Close()
+	assert.NoError(t, s.SaveValue(ctx, "permanent", "value", 0))
+	assert.NoError(t, s.SaveValue(ctx, "expiring", "value", time.Millisecond))
+
+	stored := func(key string) bool {
+		var found bool
+		require.NoError(t, s.db.View(func(tx *bbolt.Tx) error {
+			found = tx.Bucket(valuesBucket).Get([]byte(key)) != nil
+			return nil
+		}))
+		return found
+	}
+	assert.Eventually(t, func() bool { return !stored("expiring") }, time.Second, 5*time.Millisecond)
+	assert.True(t, stored("permanent"))
+}
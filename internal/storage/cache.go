@@ -0,0 +1,163 @@
+package storage
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type CacheConfig struct {
+	//Size is the number of the values kept in the memory, zero disables the cache
+	Size int `env:"CACHE_SIZE,default=10000"`
+	//TTL bounds how long the values changed by the other instances may be served, the writes of this instance
+	//are seen at once
+	TTL time.Duration `env:"CACHE_TTL,default=5s"`
+	//NegativeTTL is how long the missing values are remembered, zero disables the negative caching
+	NegativeTTL time.Duration `env:"CACHE_NEGATIVETTL,default=2s"`
+}
+
+type CacheStats struct {
+	Hits      int64 `json:"hits"`
+	Misses    int64 `json:"misses"`
+	Evictions int64 `json:"evictions"`
+	Size      int   `json:"size"`
+}
+
+type cacheEntry struct {
+	key       string
+	value     string
+	missing   bool
+	expiresAt time.Time
+}
+
+//cacheStorage keeps the recently loaded values, so the popular ones aren't read from the storage on every request.
+//The values written through it are dropped from the cache, the values written by the other instances are seen
+//when the cached ones expire.
+type cacheStorage struct {
+	storage     Storage
+	size        int
+	ttl         time.Duration
+	negativeTTL time.Duration
+	now         func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	recent  *list.List
+	//version changes on every write, so the values loaded before the write aren't cached after it
+	version uint64
+
+	hits      int64
+	misses    int64
+	evictions int64
+}
+
+func (s *cacheStorage) SaveValue(ctx context.Context, key string, value string, expiration time.Duration) error {
+	defer s.forget(key)
+	return s.storage.SaveValue(ctx, key, value, expiration)
+}
+
+func (s *cacheStorage) SaveValues(ctx context.Context, records []Record) error {
+	defer func() {
+		for _, record := range records {
+			s.forget(record.Key)
+		}
+	}()
+	return s.storage.SaveValues(ctx, records)
+}
+
+func (s *cacheStorage) CreateValue(ctx context.Context, key string, value string, expiration time.Duration) error {
+	defer s.forget(key)
+	return s.storage.CreateValue(ctx, key, value, expiration)
+}
+
+func (s *cacheStorage) UpdateValue(ctx context.Context, key string, previous string, value string, expiration time.Duration) error {
+	defer s.forget(key)
+	return s.storage.UpdateValue(ctx, key, previous, value, expiration)
+}
+
+func (s *cacheStorage) LoadValue(ctx context.Context, key string) (string, error) {
+	s.mu.Lock()
+	if e, ok := s.entries[key]; ok {
+		entry := e.Value.(*cacheEntry)
+		if s.now().Before(entry.expiresAt) {
+			s.recent.MoveToFront(e)
+			s.mu.Unlock()
+			atomic.AddInt64(&s.hits, 1)
+			if entry.missing {
+				return "", ErrNotFound
+			}
+			return entry.value, nil
+		}
+		s.remove(e)
+	}
+	version := s.version
+	s.mu.Unlock()
+	atomic.AddInt64(&s.misses, 1)
+
+	value, err := s.storage.LoadValue(ctx, key)
+	switch {
+	case err == nil:
+		s.add(version, &cacheEntry{key: key, value: value, expiresAt: s.now().Add(s.ttl)})
+	case errors.Is(err, ErrNotFound) && s.negativeTTL > 0:
+		s.add(version, &cacheEntry{key: key, missing: true, expiresAt: s.now().Add(s.negativeTTL)})
+	}
+	return value, err
+}
+
+func (s *cacheStorage) Stats() CacheStats {
+	s.mu.Lock()
+	size := s.recent.Len()
+	s.mu.Unlock()
+	return CacheStats{
+		Hits:      atomic.LoadInt64(&s.hits),
+		Misses:    atomic.LoadInt64(&s.misses),
+		Evictions: atomic.LoadInt64(&s.evictions),
+		Size:      size,
+	}
+}
+
+func (s *cacheStorage) add(version uint64, entry *cacheEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if version != s.version {
+		return
+	}
+	if e, ok := s.entries[entry.key]; ok {
+		s.remove(e)
+	}
+	s.entries[entry.key] = s.recent.PushFront(entry)
+	for s.recent.Len() > s.size {
+		s.remove(s.recent.Back())
+		atomic.AddInt64(&s.evictions, 1)
+	}
+}
+
+func (s *cacheStorage) forget(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.version++
+	if e, ok := s.entries[key]; ok {
+		s.remove(e)
+	}
+}
+
+func (s *cacheStorage) remove(e *list.Element) {
+	s.recent.Remove(e)
+	delete(s.entries, e.Value.(*cacheEntry).key)
+}
+
+//CacheStorage keeps up to the configured number of the recently loaded values in the memory
+func CacheStorage(cfg *CacheConfig, storage Storage) *cacheStorage {
+	return &cacheStorage{
+		storage:     storage,
+		size:        cfg.Size,
+		ttl:         cfg.TTL,
+		negativeTTL: cfg.NegativeTTL,
+		now:         time.Now,
+		entries:     map[string]*list.Element{},
+		recent:      list.New(),
+	}
+}
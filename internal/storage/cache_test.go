@@ -0,0 +1,180 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type mockStorage struct {
+	m *mock.Mock
+}
+
+func (s *mockStorage) SaveValue(ctx context.Context, key string, value string, expiration time.Duration) error {
+	return s.m.Called(ctx, key, value, expiration).Error(0)
+}
+
+func (s *mockStorage) SaveValues(ctx context.Context, records []Record) error {
+	return s.m.Called(ctx, records).Error(0)
+}
+
+func (s *mockStorage) CreateValue(ctx context.Context, key string, value string, expiration time.Duration) error {
+	return s.m.Called(ctx, key, value, expiration).Error(0)
+}
+
+func (s *mockStorage) UpdateValue(ctx context.Context, key string, previous string, value string, expiration time.Duration) error {
+	return s.m.Called(ctx, key, previous, value, expiration).Error(0)
+}
+
+func (s *mockStorage) LoadValue(ctx context.Context, key string) (string, error) {
+	args := s.m.Called(ctx, key)
+	return args.String(0), args.Error(1)
+}
+
+func TestCacheStorage(t *testing.T) {
+	ctx := context.Background()
+
+	Convey("Test the cache", t, func() {
+		m := &mock.Mock{}
+		now := time.Date(2020, 3, 15, 10, 30, 0, 0, time.UTC)
+		s := CacheStorage(&CacheConfig{Size: 2, TTL: time.Minute, NegativeTTL: time.Second}, &mockStorage{m: m})
+		s.now = func() time.Time { return now }
+
+		load := func(key string) (string, error) {
+			return s.LoadValue(ctx, key)
+		}
+
+		Convey("It loads the value once", func() {
+			m.On("LoadValue", mock.Anything, "key").Return("value", nil).Once()
+
+			for i := 0; i < 3; i++ {
+				value, err := load("key")
+				assert.NoError(t, err)
+				assert.Equal(t, "value", value)
+			}
+
+			m.AssertExpectations(t)
+			assert.Equal(t, CacheStats{Hits: 2, Misses: 1, Size: 1}, s.Stats())
+		})
+
+		Convey("It loads the value again when it expires", func() {
+			m.On("LoadValue", mock.Anything, "key").Return("value", nil).Twice()
+
+			load("key")
+			now = now.Add(time.Minute)
+			load("key")
+
+			m.AssertExpectations(t)
+			assert.Equal(t, CacheStats{Misses: 2, Size: 1}, s.Stats())
+		})
+
+		Convey("It remembers the missing value for a shorter time", func() {
+			m.On("LoadValue", mock.Anything, "key").Return("", ErrNotFound).Twice()
+
+			_, err := load("key")
+			assert.True(t, errors.Is(err, ErrNotFound))
+			_, err = load("key")
+			assert.True(t, errors.Is(err, ErrNotFound))
+			now = now.Add(time.Second)
+			load("key")
+
+			m.AssertExpectations(t)
+			assert.Equal(t, CacheStats{Hits: 1, Misses: 2, Size: 1}, s.Stats())
+		})
+
+		Convey("It doesn't cache the failures", func() {
+			m.On("LoadValue", mock.Anything, "key").Return("", ErrUnavailable).Twice()
+
+			load("key")
+			_, err := load("key")
+			assert.True(t, errors.Is(err, ErrUnavailable))
+
+			m.AssertExpectations(t)
+		})
+
+		Convey("It evicts the least recently used value", func() {
+			m.
+				On("LoadValue", mock.Anything, "first").Return("1", nil).Once().
+				On("LoadValue", mock.Anything, "second").Return("2", nil).Twice().
+				On("LoadValue", mock.Anything, "third").Return("3", nil).Once()
+
+			load("first")
+			load("second")
+			load("first")
+			load("third")
+			load("first")
+			load("second")
+
+			m.AssertExpectations(t)
+			assert.Equal(t, CacheStats{Hits: 2, Misses: 4, Evictions: 2, Size: 2}, s.Stats())
+		})
+
+		Convey("It forgets the values written through it", func() {
+			m.
+				On("LoadValue", mock.Anything, "key").Return("value", nil).Times(5).
+				On("SaveValue", mock.Anything, "key", "value", time.Duration(0)).Return(nil).
+				On("SaveValues", mock.Anything, []Record{{Key: "key", Value: "value"}}).Return(nil).
+				On("CreateValue", mock.Anything, "key", "value", time.Duration(0)).Return(ErrAlreadyExists).
+				On("UpdateValue", mock.Anything, "key", "value", "value", time.Duration(0)).Return(ErrValueChanged)
+
+			load("key")
+			s.SaveValue(ctx, "key", "value", 0)
+			load("key")
+			s.SaveValues(ctx, []Record{{Key: "key", Value: "value"}})
+			load("key")
+			s.CreateValue(ctx, "key", "value", 0)
+			load("key")
+			s.UpdateValue(ctx, "key", "value", "value", 0)
+			load("key")
+
+			m.AssertExpectations(t)
+		})
+
+		Convey("It doesn't cache the value loaded before the write", func() {
+			m.
+				On("LoadValue", mock.Anything, "key").Return("old", nil).Once().
+				Run(func(mock.Arguments) {
+					s.forget("key")
+				}).
+				On("LoadValue", mock.Anything, "key").Return("new", nil).Once()
+
+			load("key")
+			value, _ := load("key")
+
+			m.AssertExpectations(t)
+			assert.Equal(t, "new", value)
+		})
+	})
+}
+
+type fixedStats CacheStats
+
+func (s fixedStats) Stats() CacheStats {
+	return CacheStats(s)
+}
+
+func TestMeasureCache(t *testing.T) {
+	Convey("The counters of the cache are exposed to Prometheus", t, func() {
+		assert.NoError(t, MeasureCache(fixedStats{Hits: 3, Misses: 2, Evictions: 1, Size: 5}))
+		assert.NoError(t, MeasureCache(fixedStats{}))
+
+		expected := `
+# HELP url_shortener_storage_cache_hits_total The values loaded from the cache.
+# TYPE url_shortener_storage_cache_hits_total counter
+url_shortener_storage_cache_hits_total 3
+# HELP url_shortener_storage_cache_size The number of the cached values.
+# TYPE url_shortener_storage_cache_size gauge
+url_shortener_storage_cache_size 5
+`
+		assert.NoError(t, testutil.GatherAndCompare(prometheus.DefaultGatherer, strings.NewReader(expected),
+			"url_shortener_storage_cache_hits_total", "url_shortener_storage_cache_size"))
+	})
+}
@@ -0,0 +1,235 @@
+//Package conformance keeps the tests which every storage backend has to pass, so the backends are
+//interchangeable
+package conformance
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/stretchr/testify/assert"
+
+	"url-shortener/internal/storage"
+)
+
+//Backend is everything the service needs from a storage backend
+type Backend interface {
+	storage.Storage
+
+	Ping(ctx context.Context) error
+
+	NextInstanceIndex() (int64, error)
+
+	ReserveBlock(ctx context.Context, size int64) (start int64, err error)
+	ReleaseBlock(ctx context.Context, start int64, end int64) error
+	ReclaimBlock(ctx context.Context) (start int64, end int64, err error)
+
+	SaveHit(ctx context.Context, slug string, at time.Time) error
+	LoadHits(ctx context.Context, slug string, from time.Time, to time.Time) (int64, error)
+	LoadTotalHits(ctx context.Context, slug string) (int64, error)
+}
+
+//NewBackend returns an empty backend together with the function which moves its clock forward, so the
+//expiration is checked without waiting
+type NewBackend func() (backend Backend, advance func(d time.Duration))
+
+//Run checks the backend against the behavior expected by the service
+func Run(t *testing.T, newBackend NewBackend) {
+	ctx := context.Background()
+
+	Convey("Test the values", t, func() {
+		s, _ := newBackend()
+
+		Convey("It answers the ping", func() {
+			assert.NoError(t, s.Ping(ctx))
+		})
+
+		Convey("It reports the missing value", func() {
+			_, err := s.LoadValue(ctx, "missing")
+			assert.True(t, errors.Is(err, storage.ErrNotFound))
+		})
+
+		Convey("It saves and overwrites the value", func() {
+			assert.NoError(t, s.SaveValue(ctx, "key", "first", 0))
+			assert.NoError(t, s.SaveValue(ctx, "key", "second", 0))
+
+			value, err := s.LoadValue(ctx, "key")
+			assert.NoError(t, err)
+			assert.Equal(t, "second", value)
+		})
+
+		Convey("It saves the batch of values", func() {
+			assert.NoError(t, s.SaveValues(ctx, []storage.Record{
+				{Key: "first", Value: "1"},
+				{Key: "second", Value: "2", Expiration: time.Hour},
+			}))
+			assert.NoError(t, s.SaveValues(ctx, nil))
+
+			for key, expected := range map[string]string{"first": "1", "second": "2"} {
+				value, err := s.LoadValue(ctx, key)
+				assert.NoError(t, err)
+				assert.Equal(t, expected, value)
+			}
+		})
+
+		Convey("It creates the value only once", func() {
+			assert.NoError(t, s.CreateValue(ctx, "key", "first", 0))
+
+			err := s.CreateValue(ctx, "key", "second", 0)
+			assert.True(t, errors.Is(err, storage.ErrAlreadyExists))
+
+			value, err := s.LoadValue(ctx, "key")
+			assert.NoError(t, err)
+			assert.Equal(t, "first", value)
+		})
+
+		Convey("It updates the value which hasn't been changed", func() {
+			assert.NoError(t, s.SaveValue(ctx, "key", "first", 0))
+			assert.NoError(t, s.UpdateValue(ctx, "key", "first", "second", 0))
+
+			value, err := s.LoadValue(ctx, "key")
+			assert.NoError(t, err)
+			assert.Equal(t, "second", value)
+		})
+
+		Convey("It doesn't update the value which has been changed", func() {
+			assert.NoError(t, s.SaveValue(ctx, "key", "second", 0))
+
+			err := s.UpdateValue(ctx, "key", "first", "third", 0)
+			assert.True(t, errors.Is(err, storage.ErrValueChanged))
+
+			value, err := s.LoadValue(ctx, "key")
+			assert.NoError(t, err)
+			assert.Equal(t, "second", value)
+		})
+
+		Convey("It doesn't update the missing value", func() {
+			err := s.UpdateValue(ctx, "missing", "first", "second", 0)
+			assert.True(t, errors.Is(err, storage.ErrNotFound))
+		})
+	})
+
+	Convey("Test the expiration", t, func() {
+		s, advance := newBackend()
+
+		Convey("It keeps the value until it expires", func() {
+			assert.NoError(t, s.SaveValue(ctx, "expiring", "value", time.Minute))
+			assert.NoError(t, s.SaveValue(ctx, "permanent", "value", 0))
+
+			advance(30 * time.Second)
+			_, err := s.LoadValue(ctx, "expiring")
+			assert.NoError(t, err)
+
+			advance(time.Minute)
+			_, err = s.LoadValue(ctx, "expiring")
+			assert.True(t, errors.Is(err, storage.ErrNotFound))
+			_, err = s.LoadValue(ctx, "permanent")
+			assert.NoError(t, err)
+		})
+
+		Convey("It creates the value in place of the expired one", func() {
+			assert.NoError(t, s.CreateValue(ctx, "key", "first", time.Minute))
+			advance(2 * time.Minute)
+
+			assert.NoError(t, s.CreateValue(ctx, "key", "second", 0))
+		})
+
+		Convey("It expires the updated value", func() {
+			assert.NoError(t, s.SaveValue(ctx, "key", "first", 0))
+			assert.NoError(t, s.UpdateValue(ctx, "key", "first", "second", time.Minute))
+			advance(2 * time.Minute)
+
+			_, err := s.LoadValue(ctx, "key")
+			assert.True(t, errors.Is(err, storage.ErrNotFound))
+		})
+
+		Convey("It expires the values saved in a batch", func() {
+			assert.NoError(t, s.SaveValues(ctx, []storage.Record{{Key: "key", Value: "value", Expiration: time.Minute}}))
+			advance(2 * time.Minute)
+
+			_, err := s.LoadValue(ctx, "key")
+			assert.True(t, errors.Is(err, storage.ErrNotFound))
+		})
+	})
+
+	Convey("Test the indices", t, func() {
+		s, _ := newBackend()
+
+		Convey("It produces the increasing instance indices starting with 1", func() {
+			first, err := s.NextInstanceIndex()
+			assert.NoError(t, err)
+			assert.Equal(t, int64(1), first)
+
+			second, err := s.NextInstanceIndex()
+			assert.NoError(t, err)
+			assert.Equal(t, int64(2), second)
+		})
+
+		Convey("It reserves the successive blocks", func() {
+			first, err := s.ReserveBlock(ctx, 10)
+			assert.NoError(t, err)
+			second, err := s.ReserveBlock(ctx, 5)
+			assert.NoError(t, err)
+
+			assert.Equal(t, int64(0), first)
+			assert.Equal(t, int64(10), second)
+		})
+
+		Convey("It reclaims the released blocks in order", func() {
+			_, _, err := s.ReclaimBlock(ctx)
+			assert.True(t, errors.Is(err, storage.ErrNotFound))
+
+			assert.NoError(t, s.ReleaseBlock(ctx, 3, 10))
+			assert.NoError(t, s.ReleaseBlock(ctx, 12, 20))
+
+			start, end, err := s.ReclaimBlock(ctx)
+			assert.NoError(t, err)
+			assert.Equal(t, []int64{3, 10}, []int64{start, end})
+
+			start, end, err = s.ReclaimBlock(ctx)
+			assert.NoError(t, err)
+			assert.Equal(t, []int64{12, 20}, []int64{start, end})
+		})
+	})
+
+	Convey("Test the hits", t, func() {
+		s, _ := newBackend()
+		now := time.Now().UTC().Truncate(time.Hour)
+
+		Convey("It counts nothing for the unknown slug", func() {
+			total, err := s.LoadTotalHits(ctx, "unknown")
+			assert.NoError(t, err)
+			assert.Equal(t, int64(0), total)
+
+			hits, err := s.LoadHits(ctx, "unknown", now.Add(-time.Hour), now)
+			assert.NoError(t, err)
+			assert.Equal(t, int64(0), hits)
+		})
+
+		Convey("It counts the hits in the hourly buckets", func() {
+			for _, at := range []time.Time{
+				now.Add(-3 * time.Hour),
+				now.Add(-90 * time.Minute),
+				now.Add(-time.Hour),
+				now.Add(10 * time.Minute),
+			} {
+				assert.NoError(t, s.SaveHit(ctx, "qwe", at))
+			}
+			assert.NoError(t, s.SaveHit(ctx, "asd", now))
+
+			total, err := s.LoadTotalHits(ctx, "qwe")
+			assert.NoError(t, err)
+			assert.Equal(t, int64(4), total)
+
+			hits, err := s.LoadHits(ctx, "qwe", now.Add(-2*time.Hour), now.Add(30*time.Minute))
+			assert.NoError(t, err)
+			assert.Equal(t, int64(3), hits)
+
+			hits, err = s.LoadHits(ctx, "qwe", now.Add(-119*time.Minute), now.Add(-time.Minute))
+			assert.NoError(t, err)
+			assert.Equal(t, int64(1), hits)
+		})
+	})
+}
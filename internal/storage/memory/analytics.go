@@ -0,0 +1,67 @@
+package memory
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	hitsBucketSize = time.Hour
+	hitsRetention  = 8 * 24 * time.Hour
+)
+
+//hits are counted in the hourly buckets the same way as in Redis
+type hits struct {
+	total   int64
+	buckets map[time.Time]int64
+}
+
+func (s *storage) SaveHit(ctx context.Context, slug string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	h, ok := s.hits[slug]
+	if !ok {
+		h = &hits{buckets: map[time.Time]int64{}}
+		s.hits[slug] = h
+	}
+	h.total++
+	h.buckets[at.Truncate(hitsBucketSize).UTC()]++
+
+	for bucket := range h.buckets {
+		if s.now().Sub(bucket) > hitsRetention {
+			delete(h.buckets, bucket)
+		}
+	}
+	return nil
+}
+
+//LoadHits sums up the hourly buckets which start within the given interval
+func (s *storage) LoadHits(ctx context.Context, slug string, from time.Time, to time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	h, ok := s.hits[slug]
+	if !ok {
+		return 0, nil
+	}
+
+	var total int64
+	for bucket, n := range h.buckets {
+		if !bucket.Before(from) && !bucket.After(to) {
+			total += n
+		}
+	}
+	return total, nil
+}
+
+func (s *storage) LoadTotalHits(ctx context.Context, slug string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	h, ok := s.hits[slug]
+	if !ok {
+		return 0, nil
+	}
+	return h.total, nil
+}
@@ -0,0 +1,40 @@
+package memory
+
+import (
+	"context"
+
+	basestorage "url-shortener/internal/storage"
+)
+
+type block struct {
+	start int64
+	end   int64
+}
+
+func (s *storage) ReserveBlock(ctx context.Context, size int64) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.slugIndex += size
+	return s.slugIndex - size, nil
+}
+
+func (s *storage) ReleaseBlock(ctx context.Context, start int64, end int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.freeBlocks = append(s.freeBlocks, block{start: start, end: end})
+	return nil
+}
+
+func (s *storage) ReclaimBlock(ctx context.Context) (int64, int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.freeBlocks) == 0 {
+		return 0, 0, basestorage.ErrNotFound
+	}
+	b := s.freeBlocks[0]
+	s.freeBlocks = s.freeBlocks[1:]
+	return b.start, b.end, nil
+}
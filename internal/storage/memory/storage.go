@@ -0,0 +1,127 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	basestorage "url-shortener/internal/storage"
+)
+
+//value is kept until the expiration time, the zero time means forever
+type value struct {
+	data      string
+	expiresAt time.Time
+}
+
+//storage keeps everything in the memory of the process, so it's lost on restart. It's meant for the local
+//development and the tests, where running Redis is an overkill.
+type storage struct {
+	mu            sync.Mutex
+	values        map[string]value
+	instanceIndex int64
+	slugIndex     int64
+	freeBlocks    []block
+	hits          map[string]*hits
+	now           func() time.Time
+}
+
+func (s *storage) Close() error {
+	return nil
+}
+
+func (s *storage) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (s *storage) NextInstanceIndex() (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.instanceIndex++
+	return s.instanceIndex, nil
+}
+
+func (s *storage) SaveValue(ctx context.Context, key string, value string, expiration time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.save(key, value, expiration)
+	return nil
+}
+
+func (s *storage) SaveValues(ctx context.Context, records []basestorage.Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, record := range records {
+		s.save(record.Key, record.Value, record.Expiration)
+	}
+	return nil
+}
+
+func (s *storage) CreateValue(ctx context.Context, key string, value string, expiration time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.load(key); ok {
+		return basestorage.ErrAlreadyExists
+	}
+	s.save(key, value, expiration)
+	return nil
+}
+
+func (s *storage) UpdateValue(ctx context.Context, key string, previous string, value string, expiration time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.load(key)
+	if !ok {
+		return basestorage.ErrNotFound
+	}
+	if current != previous {
+		return basestorage.ErrValueChanged
+	}
+	s.save(key, value, expiration)
+	return nil
+}
+
+func (s *storage) LoadValue(ctx context.Context, key string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	value, ok := s.load(key)
+	if !ok {
+		return "", basestorage.ErrNotFound
+	}
+	return value, nil
+}
+
+func (s *storage) save(key string, data string, expiration time.Duration) {
+	v := value{data: data}
+	if expiration > 0 {
+		v.expiresAt = s.now().Add(expiration)
+	}
+	s.values[key] = v
+}
+
+//load drops the expired value, so the expired keys don't pile up
+func (s *storage) load(key string) (string, bool) {
+	v, ok := s.values[key]
+	if !ok {
+		return "", false
+	}
+	if !v.expiresAt.IsZero() && !s.now().Before(v.expiresAt) {
+		delete(s.values, key)
+		return "", false
+	}
+	return v.data, true
+}
+
+func NewStorage() *storage {
+	return &storage{
+		values: map[string]value{},
+		hits:   map[string]*hits{},
+		now:    time.Now,
+	}
+}
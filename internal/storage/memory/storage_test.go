@@ -0,0 +1,17 @@
+package memory
+
+import (
+	"testing"
+	"time"
+
+	"url-shortener/internal/storage/conformance"
+)
+
+func TestStorage(t *testing.T) {
+	conformance.Run(t, func() (conformance.Backend, func(time.Duration)) {
+		now := time.Now()
+		s := NewStorage()
+		s.now = func() time.Time { return now }
+		return s, func(d time.Duration) { now = now.Add(d) }
+	})
+}
@@ -0,0 +1,114 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	operationDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "url_shortener",
+		Subsystem: "storage",
+		Name:      "operation_duration_seconds",
+		Help:      "The time taken by the storage operations.",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+	}, []string{"operation"})
+	operationErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "url_shortener",
+		Subsystem: "storage",
+		Name:      "operation_errors_total",
+		Help:      "The storage operations failed for another reason than the state of the values.",
+	}, []string{"operation"})
+)
+
+type metricsStorage struct {
+	storage Storage
+}
+
+func (s *metricsStorage) SaveValue(ctx context.Context, key string, value string, expiration time.Duration) error {
+	defer measure("SaveValue", time.Now())
+	return observe("SaveValue", s.storage.SaveValue(ctx, key, value, expiration))
+}
+
+func (s *metricsStorage) SaveValues(ctx context.Context, records []Record) error {
+	defer measure("SaveValues", time.Now())
+	return observe("SaveValues", s.storage.SaveValues(ctx, records))
+}
+
+func (s *metricsStorage) CreateValue(ctx context.Context, key string, value string, expiration time.Duration) error {
+	defer measure("CreateValue", time.Now())
+	return observe("CreateValue", s.storage.CreateValue(ctx, key, value, expiration))
+}
+
+func (s *metricsStorage) UpdateValue(ctx context.Context, key string, previous string, value string, expiration time.Duration) error {
+	defer measure("UpdateValue", time.Now())
+	return observe("UpdateValue", s.storage.UpdateValue(ctx, key, previous, value, expiration))
+}
+
+func (s *metricsStorage) LoadValue(ctx context.Context, key string) (string, error) {
+	defer measure("LoadValue", time.Now())
+	value, err := s.storage.LoadValue(ctx, key)
+	return value, observe("LoadValue", err)
+}
+
+func measure(operation string, start time.Time) {
+	operationDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+}
+
+//observe counts the error unless it's the expected outcome of the operation
+func observe(operation string, err error) error {
+	if err != nil && !errors.Is(err, ErrNotFound) && !errors.Is(err, ErrAlreadyExists) && !errors.Is(err, ErrValueChanged) {
+		operationErrors.WithLabelValues(operation).Inc()
+	}
+	return err
+}
+
+//MeasureStorage exposes the duration and the failures of the operations to Prometheus
+func MeasureStorage(storage Storage) Storage {
+	return &metricsStorage{
+		storage: storage,
+	}
+}
+
+var (
+	cacheHitsDesc = prometheus.NewDesc("url_shortener_storage_cache_hits_total",
+		"The values loaded from the cache.", nil, nil)
+	cacheMissesDesc = prometheus.NewDesc("url_shortener_storage_cache_misses_total",
+		"The values loaded from the storage because they weren't cached.", nil, nil)
+	cacheEvictionsDesc = prometheus.NewDesc("url_shortener_storage_cache_evictions_total",
+		"The values dropped from the full cache.", nil, nil)
+	cacheSizeDesc = prometheus.NewDesc("url_shortener_storage_cache_size",
+		"The number of the cached values.", nil, nil)
+)
+
+type cacheCollector struct {
+	cache interface{ Stats() CacheStats }
+}
+
+func (c cacheCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- cacheHitsDesc
+	ch <- cacheMissesDesc
+	ch <- cacheEvictionsDesc
+	ch <- cacheSizeDesc
+}
+
+func (c cacheCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.cache.Stats()
+	ch <- prometheus.MustNewConstMetric(cacheHitsDesc, prometheus.CounterValue, float64(stats.Hits))
+	ch <- prometheus.MustNewConstMetric(cacheMissesDesc, prometheus.CounterValue, float64(stats.Misses))
+	ch <- prometheus.MustNewConstMetric(cacheEvictionsDesc, prometheus.CounterValue, float64(stats.Evictions))
+	ch <- prometheus.MustNewConstMetric(cacheSizeDesc, prometheus.GaugeValue, float64(stats.Size))
+}
+
+//MeasureCache exposes the counters of the cache to Prometheus, only the first cache of the process is registered
+func MeasureCache(cache interface{ Stats() CacheStats }) error {
+	err := prometheus.Register(cacheCollector{cache: cache})
+	if errors.As(err, &prometheus.AlreadyRegisteredError{}) {
+		return nil
+	}
+	return err
+}
@@ -2,6 +2,7 @@ package storage
 
 import (
 	"context"
+	"time"
 
 	"github.com/opentracing/opentracing-go"
 )
@@ -10,10 +11,29 @@ type otStorage struct {
 	storage Storage
 }
 
-func (s *otStorage) SaveValue(ctx context.Context, key string, value string) error {
+func (s *otStorage) SaveValue(ctx context.Context, key string, value string, expiration time.Duration) error {
 	span, ctx := opentracing.StartSpanFromContext(ctx, "SaveValue")
 	defer span.Finish()
-	return s.storage.SaveValue(ctx, key, value)
+	return s.storage.SaveValue(ctx, key, value, expiration)
+}
+
+func (s *otStorage) SaveValues(ctx context.Context, records []Record) error {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "SaveValues")
+	defer span.Finish()
+	span.SetTag("records", len(records))
+	return s.storage.SaveValues(ctx, records)
+}
+
+func (s *otStorage) CreateValue(ctx context.Context, key string, value string, expiration time.Duration) error {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "CreateValue")
+	defer span.Finish()
+	return s.storage.CreateValue(ctx, key, value, expiration)
+}
+
+func (s *otStorage) UpdateValue(ctx context.Context, key string, previous string, value string, expiration time.Duration) error {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "UpdateValue")
+	defer span.Finish()
+	return s.storage.UpdateValue(ctx, key, previous, value, expiration)
 }
 
 func (s *otStorage) LoadValue(ctx context.Context, key string) (string, error) {
@@ -0,0 +1,40 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+const hitsBucketSize = time.Hour
+
+//SaveHit counts the hit in the total and the hourly counters in one statement. The hourly counters are kept for
+//the reports until they are out of the retention.
+func (s *storage) SaveHit(ctx context.Context, slug string, at time.Time) error {
+	_, err := s.db.ExecContext(ctx, `
+WITH total AS (
+	INSERT INTO total_hits (slug, count) VALUES ($1, 1)
+	ON CONFLICT (slug) DO UPDATE SET count = total_hits.count + 1
+)
+INSERT INTO hits (slug, bucket, count) VALUES ($1, $2, 1)
+ON CONFLICT (slug, bucket) DO UPDATE SET count = hits.count + 1`, slug, at.Truncate(hitsBucketSize))
+	return wrapError(err)
+}
+
+//LoadHits sums up the hourly buckets which start within the given interval
+func (s *storage) LoadHits(ctx context.Context, slug string, from time.Time, to time.Time) (int64, error) {
+	var hits int64
+	err := s.db.QueryRowContext(ctx, `
+SELECT coalesce(sum(count), 0) FROM hits
+WHERE slug = $1 AND bucket >= $2 AND bucket <= $3`, slug, from, to).Scan(&hits)
+	return hits, wrapError(err)
+}
+
+func (s *storage) LoadTotalHits(ctx context.Context, slug string) (int64, error) {
+	var hits int64
+	err := s.db.QueryRowContext(ctx, `SELECT count FROM total_hits WHERE slug = $1`, slug).Scan(&hits)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return hits, wrapError(err)
+}
@@ -0,0 +1,35 @@
+package postgres
+
+import (
+	"context"
+)
+
+func (s *storage) ReserveBlock(ctx context.Context, size int64) (int64, error) {
+	var end int64
+	err := s.db.QueryRowContext(ctx, `
+INSERT INTO counters (name, value) VALUES ('slug_index', $1)
+ON CONFLICT (name) DO UPDATE SET value = counters.value + excluded.value
+RETURNING value`, size).Scan(&end)
+	if err != nil {
+		return 0, wrapError(err)
+	}
+	return end - size, nil
+}
+
+func (s *storage) ReleaseBlock(ctx context.Context, start int64, end int64) error {
+	_, err := s.db.ExecContext(ctx, `INSERT INTO free_blocks (start_index, end_index) VALUES ($1, $2)`, start, end)
+	return wrapError(err)
+}
+
+//ReclaimBlock takes the oldest block, the blocks being reclaimed by the other instances are skipped
+func (s *storage) ReclaimBlock(ctx context.Context) (int64, int64, error) {
+	var start, end int64
+	err := s.db.QueryRowContext(ctx, `
+DELETE FROM free_blocks
+WHERE id = (SELECT id FROM free_blocks ORDER BY id LIMIT 1 FOR UPDATE SKIP LOCKED)
+RETURNING start_index, end_index`).Scan(&start, &end)
+	if err != nil {
+		return 0, 0, wrapError(err)
+	}
+	return start, end, nil
+}
@@ -0,0 +1,14 @@
+package postgres
+
+import "time"
+
+type Config struct {
+	//DSN usually contains the password, so it isn't logged with the config
+	DSN          string `env:"POSTGRES_DSN" json:"-"`
+	MaxOpenConns int    `env:"POSTGRES_MAXOPENCONNS,default=10"`
+	//SweepInterval is how often the expired records and the old hits are removed, zero removes them only when the
+	//storage is opened
+	SweepInterval time.Duration `env:"POSTGRES_SWEEPINTERVAL,default=1h"`
+	//HitsRetention is how long the hourly hits are kept for the reports, zero keeps them forever
+	HitsRetention time.Duration `env:"POSTGRES_HITSRETENTION,default=2160h"`
+}
@@ -0,0 +1,99 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+)
+
+//The key of the advisory lock which makes the instances started together apply the migrations one by one
+const migrationsLock = 7243531
+
+//migrations are applied in order and never changed once released, a change of the schema is a new migration
+var migrations = []string{
+	`
+CREATE TABLE records (
+	key        text PRIMARY KEY,
+	value      text NOT NULL,
+	expires_at timestamptz
+);
+CREATE INDEX records_expires_at_idx ON records (expires_at) WHERE expires_at IS NOT NULL;
+
+CREATE SEQUENCE instance_index;
+
+CREATE TABLE counters (
+	name  text PRIMARY KEY,
+	value bigint NOT NULL
+);
+
+CREATE TABLE free_blocks (
+	id          bigserial PRIMARY KEY,
+	start_index bigint NOT NULL,
+	end_index   bigint NOT NULL
+);
+
+CREATE TABLE hits (
+	slug   text NOT NULL,
+	bucket timestamptz NOT NULL,
+	count  bigint NOT NULL,
+	PRIMARY KEY (slug, bucket)
+);
+
+CREATE TABLE total_hits (
+	slug  text PRIMARY KEY,
+	count bigint NOT NULL
+);
+`,
+	`
+ALTER TABLE records ADD COLUMN document jsonb;
+UPDATE records SET document = value::jsonb WHERE left(value, 1) = '{';
+
+CREATE VIEW links AS
+SELECT
+	key,
+	document->>'url' AS url,
+	(document->>'created_at')::timestamptz AS created_at,
+	(document->>'updated_at')::timestamptz AS updated_at,
+	expires_at,
+	coalesce((document->>'redirect_code')::integer, 0) AS redirect_code,
+	document->>'creator' AS creator,
+	ARRAY(SELECT jsonb_array_elements_text(coalesce(document->'tags', '[]'::jsonb))) AS tags,
+	coalesce((document->>'disabled')::boolean, false) AS disabled
+FROM records
+WHERE document ? 'v' AND document ? 'url';
+`,
+}
+
+//migrate brings the schema up to date, the applied migrations are recorded in schema_migrations
+func migrate(ctx context.Context, db *sql.DB) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, migrationsLock); err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `
+CREATE TABLE IF NOT EXISTS schema_migrations (
+	version    integer PRIMARY KEY,
+	applied_at timestamptz NOT NULL DEFAULT now()
+)`)
+	if err != nil {
+		return err
+	}
+
+	var version int
+	if err := tx.QueryRowContext(ctx, `SELECT coalesce(max(version), 0) FROM schema_migrations`).Scan(&version); err != nil {
+		return err
+	}
+	for ; version < len(migrations); version++ {
+		if _, err := tx.ExecContext(ctx, migrations[version]); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `INSERT INTO schema_migrations (version) VALUES ($1)`, version+1); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
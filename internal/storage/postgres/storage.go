@@ -0,0 +1,225 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	// The driver is registered for database/sql
+	_ "github.com/lib/pq"
+
+	"url-shortener/internal/logger/log"
+	basestorage "url-shortener/internal/storage"
+)
+
+const (
+	saveQuery = `
+INSERT INTO records (key, value, document, expires_at) VALUES ($1, $2, $3::jsonb, $4)
+ON CONFLICT (key) DO UPDATE SET value = excluded.value, document = excluded.document, expires_at = excluded.expires_at`
+
+	//createQuery replaces only the expired record, so the existing one is reported by the number of affected rows
+	createQuery = `
+INSERT INTO records (key, value, document, expires_at) VALUES ($1, $2, $3::jsonb, $4)
+ON CONFLICT (key) DO UPDATE SET value = excluded.value, document = excluded.document, expires_at = excluded.expires_at
+WHERE records.expires_at IS NOT NULL AND records.expires_at <= $5`
+
+	updateQuery = `
+UPDATE records SET value = $3, document = $4::jsonb, expires_at = $5
+WHERE key = $1 AND value = $2 AND (expires_at IS NULL OR expires_at > $6)`
+
+	loadQuery = `SELECT value FROM records WHERE key = $1 AND (expires_at IS NULL OR expires_at > $2)`
+)
+
+//storage keeps the values in the records table, the expired records are ignored and removed by the periodic sweep
+//and when the storage is opened. The JSON values are kept in the document column too, so the links can be queried
+//in the links view.
+type storage struct {
+	db            *sql.DB
+	now           func() time.Time
+	hitsRetention time.Duration
+
+	//cancel stops the sweep, done is closed when it's stopped
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func (s *storage) Close() error {
+	s.cancel()
+	<-s.done
+	return s.db.Close()
+}
+
+func (s *storage) Ping(ctx context.Context) error {
+	return wrapError(s.db.PingContext(ctx))
+}
+
+func (s *storage) NextInstanceIndex() (int64, error) {
+	var index int64
+	err := s.db.QueryRow(`SELECT nextval('instance_index')`).Scan(&index)
+	return index, wrapError(err)
+}
+
+func (s *storage) SaveValue(ctx context.Context, key string, value string, expiration time.Duration) error {
+	_, err := s.db.ExecContext(ctx, saveQuery, key, value, document(value), s.expiresAt(expiration))
+	return wrapError(err)
+}
+
+func (s *storage) SaveValues(ctx context.Context, records []basestorage.Record) error {
+	if len(records) == 0 {
+		return nil
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return wrapError(err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, saveQuery)
+	if err != nil {
+		return wrapError(err)
+	}
+	defer stmt.Close()
+
+	for _, record := range records {
+		if _, err := stmt.ExecContext(ctx, record.Key, record.Value, document(record.Value), s.expiresAt(record.Expiration)); err != nil {
+			return wrapError(err)
+		}
+	}
+	return wrapError(tx.Commit())
+}
+
+func (s *storage) CreateValue(ctx context.Context, key string, value string, expiration time.Duration) error {
+	result, err := s.db.ExecContext(ctx, createQuery, key, value, document(value), s.expiresAt(expiration), s.now())
+	if err != nil {
+		return wrapError(err)
+	}
+	created, err := result.RowsAffected()
+	if err != nil {
+		return wrapError(err)
+	}
+	if created == 0 {
+		return basestorage.ErrAlreadyExists
+	}
+	return nil
+}
+
+func (s *storage) UpdateValue(ctx context.Context, key string, previous string, value string, expiration time.Duration) error {
+	result, err := s.db.ExecContext(ctx, updateQuery, key, previous, value, document(value), s.expiresAt(expiration), s.now())
+	if err != nil {
+		return wrapError(err)
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return wrapError(err)
+	}
+	if updated > 0 {
+		return nil
+	}
+
+	// Nothing has been updated, so either the record is missing or its value is different
+	if _, err := s.LoadValue(ctx, key); err != nil {
+		return err
+	}
+	return basestorage.ErrValueChanged
+}
+
+func (s *storage) LoadValue(ctx context.Context, key string) (string, error) {
+	var value string
+	err := s.db.QueryRowContext(ctx, loadQuery, key, s.now()).Scan(&value)
+	return value, wrapError(err)
+}
+
+func (s *storage) expiresAt(expiration time.Duration) sql.NullTime {
+	if expiration <= 0 {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: s.now().Add(expiration), Valid: true}
+}
+
+//document returns the JSON objects, the rest of the values aren't documents
+func document(value string) sql.NullString {
+	if !strings.HasPrefix(value, "{") || !json.Valid([]byte(value)) {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: value, Valid: true}
+}
+
+//removeExpired drops the expired records and the hits which are out of the retention
+func (s *storage) removeExpired(ctx context.Context) error {
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM records WHERE expires_at <= $1`, s.now()); err != nil {
+		return err
+	}
+	if s.hitsRetention <= 0 {
+		return nil
+	}
+	_, err := s.db.ExecContext(ctx, `DELETE FROM hits WHERE bucket < $1`, s.now().Add(-s.hitsRetention))
+	return err
+}
+
+//sweep removes the expired records until the context is done, so the tables of a long-running process don't grow
+//without bound
+func (s *storage) sweep(ctx context.Context, interval time.Duration) {
+	defer close(s.done)
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.removeExpired(ctx); err != nil && ctx.Err() == nil {
+				log.Logger.Error().Err(err).Msg("Cannot remove the expired records")
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+//wrapError turns the driver errors into the storage ones, so the callers don't depend on the driver
+func wrapError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, sql.ErrNoRows):
+		return basestorage.ErrNotFound
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, context.Canceled):
+		return err
+	}
+	return fmt.Errorf("%w: %v", basestorage.ErrUnavailable, err)
+}
+
+func NewStorage(cfg *Config) (*storage, error) {
+	db, err := sql.Open("postgres", cfg.DSN)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+
+	s := &storage{
+		db:            db,
+		now:           time.Now,
+		hitsRetention: cfg.HitsRetention,
+		done:          make(chan struct{}),
+	}
+	ctx := context.Background()
+	if err := migrate(ctx, db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("Cannot migrate the schema: %w", wrapError(err))
+	}
+	if err := s.removeExpired(ctx); err != nil {
+		db.Close()
+		return nil, wrapError(err)
+	}
+
+	ctx, s.cancel = context.WithCancel(ctx)
+	go s.sweep(ctx, cfg.SweepInterval)
+	return s, nil
+}
@@ -0,0 +1,93 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis"
+
+	basestorage "url-shortener/internal/storage"
+)
+
+const (
+	hitsBucketSize = time.Hour
+	hitsRetention  = 8 * 24 * time.Hour
+)
+
+//The slug is wrapped into braces to keep all the counters of a link in the same hash slot
+func hitsTotalKey(slug string) string {
+	return fmt.Sprintf("hits:{%s}:total", slug)
+}
+
+func hitsBucketKey(slug string, bucket time.Time) string {
+	return fmt.Sprintf("hits:{%s}:%d", slug, bucket.Unix())
+}
+
+func (s *storage) SaveHit(ctx context.Context, slug string, at time.Time) error {
+	bucket := hitsBucketKey(slug, at.Truncate(hitsBucketSize))
+
+	return s.do(ctx, func(client redis.Cmdable) error {
+		pipe := client.Pipeline()
+		pipe.Incr(hitsTotalKey(slug))
+		pipe.Incr(bucket)
+		pipe.Expire(bucket, hitsRetention)
+		_, err := pipe.Exec()
+		return err
+	})
+}
+
+//LoadHits sums up the hourly buckets which start within the given interval
+func (s *storage) LoadHits(ctx context.Context, slug string, from time.Time, to time.Time) (int64, error) {
+	first := from.Truncate(hitsBucketSize)
+	if first.Before(from) {
+		first = first.Add(hitsBucketSize)
+	}
+
+	keys := []string{}
+	for bucket := first; !bucket.After(to); bucket = bucket.Add(hitsBucketSize) {
+		keys = append(keys, hitsBucketKey(slug, bucket))
+	}
+	if len(keys) == 0 {
+		return 0, nil
+	}
+
+	var values []interface{}
+	err := s.do(ctx, func(client redis.Cmdable) (err error) {
+		values, err = client.MGet(keys...).Result()
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	var hits int64
+	for _, v := range values {
+		if v == nil {
+			continue
+		}
+		n, err := strconv.ParseInt(v.(string), 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		hits += n
+	}
+	return hits, nil
+}
+
+func (s *storage) LoadTotalHits(ctx context.Context, slug string) (int64, error) {
+	var hits int64
+	err := s.do(ctx, func(client redis.Cmdable) (err error) {
+		hits, err = client.Get(hitsTotalKey(slug)).Int64()
+		return err
+	})
+	if errors.Is(err, basestorage.ErrNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return hits, nil
+}
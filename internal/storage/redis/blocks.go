@@ -0,0 +1,43 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-redis/redis"
+)
+
+func (s *storage) ReserveBlock(ctx context.Context, size int64) (int64, error) {
+	var end int64
+	err := s.do(ctx, func(client redis.Cmdable) (err error) {
+		end, err = client.IncrBy(s.slugIndexKey, size).Result()
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return end - size, nil
+}
+
+func (s *storage) ReleaseBlock(ctx context.Context, start int64, end int64) error {
+	return s.do(ctx, func(client redis.Cmdable) error {
+		return client.RPush(s.freeBlocksKey, fmt.Sprintf("%d:%d", start, end)).Err()
+	})
+}
+
+func (s *storage) ReclaimBlock(ctx context.Context) (int64, int64, error) {
+	var block string
+	err := s.do(ctx, func(client redis.Cmdable) (err error) {
+		block, err = client.LPop(s.freeBlocksKey).Result()
+		return err
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var start, end int64
+	if _, err := fmt.Sscanf(block, "%d:%d", &start, &end); err != nil {
+		return 0, 0, err
+	}
+	return start, end, nil
+}
@@ -1,8 +1,45 @@
 package redis
 
+import (
+	"errors"
+	"time"
+)
+
+//The single node is used unless either MasterName or Cluster is set. All the keys used together by one command
+//share a hash tag, so they work under the cluster slotting.
 type Config struct {
-	Address          string `env:"REDIS_ADDRESS,required"`
-	Database         int    `env:"REDIS_DATABASE,required"`
-	Password         string `env:"REDIS_PASSWORD"`
-	InstanceIndexKey string `env:"REDIS_INSTANCEINDEXKEY,default=instance_index"`
+	Address string `env:"REDIS_ADDRESS"`
+	//Addresses are the sentinels if MasterName is set or the seed nodes if Cluster is set
+	Addresses        []string `env:"REDIS_ADDRESSES"`
+	MasterName       string   `env:"REDIS_MASTERNAME"`
+	Cluster          bool     `env:"REDIS_CLUSTER,default=false"`
+	Database         int      `env:"REDIS_DATABASE,default=0"`
+	Password         string   `env:"REDIS_PASSWORD"`
+	InstanceIndexKey string   `env:"REDIS_INSTANCEINDEXKEY,default=instance_index"`
+	SlugIndexKey     string   `env:"REDIS_SLUGINDEXKEY,default=slug_index"`
+	FreeBlocksKey    string   `env:"REDIS_FREEBLOCKSKEY,default=free_slug_blocks"`
+	//OperationTimeout limits every call to the storage in addition to the deadline of the request, zero disables it
+	OperationTimeout time.Duration `env:"REDIS_OPERATIONTIMEOUT,default=1s"`
+	//PoolSize is the number of connections per node, zero means 10 per CPU
+	PoolSize     int           `env:"REDIS_POOLSIZE,default=0"`
+	MinIdleConns int           `env:"REDIS_MINIDLECONNS,default=0"`
+	DialTimeout  time.Duration `env:"REDIS_DIALTIMEOUT,default=5s"`
+	ReadTimeout  time.Duration `env:"REDIS_READTIMEOUT,default=3s"`
+	WriteTimeout time.Duration `env:"REDIS_WRITETIMEOUT,default=3s"`
+}
+
+func (c *Config) Validate() error {
+	switch {
+	case c.MasterName != "" && c.Cluster:
+		return errors.New("The redis master name cannot be used with the cluster")
+	case c.MasterName != "" && len(c.Addresses) == 0:
+		return errors.New("The redis sentinel addresses must be set")
+	case c.Cluster && len(c.Addresses) == 0:
+		return errors.New("The redis cluster addresses must be set")
+	case c.Cluster && c.Database != 0:
+		return errors.New("The redis cluster has only the database 0")
+	case c.MasterName == "" && !c.Cluster && c.Address == "":
+		return errors.New("The redis address must be set")
+	}
+	return nil
 }
@@ -0,0 +1,26 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/go-redis/redis"
+
+	basestorage "url-shortener/internal/storage"
+)
+
+//wrapError turns the client errors into the storage ones, so the callers don't depend on the driver. The socket
+//timeouts are reported as the exceeded deadline like the timeouts of the operations.
+func wrapError(err error) error {
+	switch err {
+	case nil:
+		return nil
+	case redis.Nil:
+		return basestorage.ErrNotFound
+	}
+	if e, ok := err.(net.Error); ok && e.Timeout() {
+		return fmt.Errorf("%w: %v", context.DeadlineExceeded, err)
+	}
+	return fmt.Errorf("%w: %v", basestorage.ErrUnavailable, err)
+}
@@ -0,0 +1,62 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+//takeTokenScript refills the bucket kept as the hash of the tokens and the time it was updated last in
+//milliseconds, then takes a token. The bucket expires when it would have been full anyway.
+var takeTokenScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'updated')
+local tokens = tonumber(state[1])
+local updated = tonumber(state[2])
+if not tokens or not updated then
+	tokens = burst
+	updated = now
+end
+if now > updated then
+	tokens = math.min(burst, tokens + (now - updated) * rate / 1000)
+	updated = now
+end
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+redis.call('HMSET', KEYS[1], 'tokens', tostring(tokens), 'updated', tostring(updated))
+redis.call('PEXPIRE', KEYS[1], math.ceil((burst - tokens) * 1000 / rate) + 1000)
+return {allowed, tostring(tokens)}
+`)
+
+//TakeToken shares the buckets between the instances, the time is taken from the instances, so their clocks must
+//be in sync
+func (s *storage) TakeToken(ctx context.Context, key string, rate float64, burst int, now time.Time) (bool, float64, error) {
+	var reply interface{}
+	err := s.do(ctx, func(client redis.Cmdable) (err error) {
+		reply, err = takeTokenScript.Run(client, []string{key}, rate, burst, now.UnixNano()/int64(time.Millisecond)).Result()
+		return err
+	})
+	if err != nil {
+		return false, 0, err
+	}
+
+	result, ok := reply.([]interface{})
+	if !ok || len(result) != 2 {
+		return false, 0, fmt.Errorf("The reply of the rate limiter is unexpected: %v", reply)
+	}
+	allowed, _ := result[0].(int64)
+	value, _ := result[1].(string)
+	tokens, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return false, 0, err
+	}
+	return allowed == 1, tokens, nil
+}
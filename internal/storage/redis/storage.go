@@ -2,40 +2,217 @@ package redis
 
 import (
 	"context"
+	"time"
 
 	"github.com/go-redis/redis"
+
+	basestorage "url-shortener/internal/storage"
 )
 
+//updateScript replaces the value if it hasn't been changed since it was read. It returns -1 if the key doesn't
+//exist and 0 if the value differs.
+var updateScript = redis.NewScript(`
+local current = redis.call('GET', KEYS[1])
+if not current then
+	return -1
+end
+if current ~= ARGV[1] then
+	return 0
+end
+if tonumber(ARGV[3]) > 0 then
+	redis.call('SET', KEYS[1], ARGV[2], 'PX', ARGV[3])
+else
+	redis.call('SET', KEYS[1], ARGV[2])
+end
+return 1
+`)
+
 type storage struct {
-	client           *redis.Client
+	client           redis.UniversalClient
 	instanceIndexKey string
+	slugIndexKey     string
+	freeBlocksKey    string
+	timeout          time.Duration
+}
+
+//do runs the commands with the context bound to the client. The client doesn't watch the context on its own, the
+//commands are bounded by the read and write timeouts, which don't exceed the operation timeout, so the context is
+//checked before the commands and its error is reported if it's done by the time they fail.
+func (s *storage) do(ctx context.Context, commands func(client redis.Cmdable) error) error {
+	if s.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.timeout)
+		defer cancel()
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	err := commands(withContext(ctx, s.client))
+	if err != nil && err != redis.Nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return wrapError(err)
+}
+
+//withContext binds the context to the client, so it's passed to the hooks of the client
+func withContext(ctx context.Context, client redis.UniversalClient) redis.Cmdable {
+	switch c := client.(type) {
+	case *redis.Client:
+		return c.WithContext(ctx)
+	case *redis.ClusterClient:
+		return c.WithContext(ctx)
+	}
+	return client
 }
 
 func (s *storage) Close() error {
 	return s.client.Close()
 }
 
+func (s *storage) Ping(ctx context.Context) error {
+	return s.do(ctx, func(client redis.Cmdable) error {
+		return client.Ping().Err()
+	})
+}
+
 func (s *storage) NextInstanceIndex() (int64, error) {
-	return s.client.Incr(s.instanceIndexKey).Result()
+	var index int64
+	err := s.do(context.Background(), func(client redis.Cmdable) (err error) {
+		index, err = client.Incr(s.instanceIndexKey).Result()
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return index, nil
+}
+
+func (s *storage) SaveValue(ctx context.Context, key string, value string, expiration time.Duration) error {
+	return s.do(ctx, func(client redis.Cmdable) error {
+		return client.Set(key, value, expiration).Err()
+	})
 }
 
-func (s *storage) SaveValue(ctx context.Context, key string, value string) error {
-	return s.client.Set(key, value, 0).Err()
+func (s *storage) SaveValues(ctx context.Context, records []basestorage.Record) error {
+	if len(records) == 0 {
+		return nil
+	}
+	return s.do(ctx, func(client redis.Cmdable) error {
+		pipe := client.Pipeline()
+		for _, record := range records {
+			pipe.Set(record.Key, record.Value, record.Expiration)
+		}
+		_, err := pipe.Exec()
+		return err
+	})
+}
+
+func (s *storage) CreateValue(ctx context.Context, key string, value string, expiration time.Duration) error {
+	var created bool
+	err := s.do(ctx, func(client redis.Cmdable) (err error) {
+		created, err = client.SetNX(key, value, expiration).Result()
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if !created {
+		return basestorage.ErrAlreadyExists
+	}
+	return nil
+}
+
+func (s *storage) UpdateValue(ctx context.Context, key string, previous string, value string, expiration time.Duration) error {
+	var result int
+	err := s.do(ctx, func(client redis.Cmdable) (err error) {
+		result, err = updateScript.Run(client, []string{key}, previous, value, expiration.Milliseconds()).Int()
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	switch result {
+	case -1:
+		return basestorage.ErrNotFound
+	case 0:
+		return basestorage.ErrValueChanged
+	}
+	return nil
 }
 
 func (s *storage) LoadValue(ctx context.Context, key string) (string, error) {
-	return s.client.Get(key).Result()
+	var value string
+	err := s.do(ctx, func(client redis.Cmdable) (err error) {
+		value, err = client.Get(key).Result()
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	return value, nil
 }
 
-func NewStorage(cfg *Config) *storage {
+func NewStorage(cfg *Config) (*storage, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
 	return &storage{
-		client: redis.NewClient(
-			&redis.Options{
-				Addr:     cfg.Address,
-				Password: cfg.Password,
-				DB:       cfg.Database,
-			},
-		),
+		client:           newClient(cfg),
 		instanceIndexKey: cfg.InstanceIndexKey,
+		slugIndexKey:     cfg.SlugIndexKey,
+		freeBlocksKey:    cfg.FreeBlocksKey,
+		timeout:          cfg.OperationTimeout,
+	}, nil
+}
+
+//newClient limits the socket timeouts by the operation timeout, so a call doesn't outlive the operation for long
+func newClient(cfg *Config) redis.UniversalClient {
+	readTimeout, writeTimeout := cfg.ReadTimeout, cfg.WriteTimeout
+	if cfg.OperationTimeout > 0 {
+		readTimeout = minDuration(readTimeout, cfg.OperationTimeout)
+		writeTimeout = minDuration(writeTimeout, cfg.OperationTimeout)
+	}
+	switch {
+	case cfg.MasterName != "":
+		return redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:    cfg.MasterName,
+			SentinelAddrs: cfg.Addresses,
+			Password:      cfg.Password,
+			DB:            cfg.Database,
+			PoolSize:      cfg.PoolSize,
+			MinIdleConns:  cfg.MinIdleConns,
+			DialTimeout:   cfg.DialTimeout,
+			ReadTimeout:   readTimeout,
+			WriteTimeout:  writeTimeout,
+		})
+	case cfg.Cluster:
+		return redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:        cfg.Addresses,
+			Password:     cfg.Password,
+			PoolSize:     cfg.PoolSize,
+			MinIdleConns: cfg.MinIdleConns,
+			DialTimeout:  cfg.DialTimeout,
+			ReadTimeout:  readTimeout,
+			WriteTimeout: writeTimeout,
+		})
+	}
+	return redis.NewClient(&redis.Options{
+		Addr:         cfg.Address,
+		Password:     cfg.Password,
+		DB:           cfg.Database,
+		PoolSize:     cfg.PoolSize,
+		MinIdleConns: cfg.MinIdleConns,
+		DialTimeout:  cfg.DialTimeout,
+		ReadTimeout:  readTimeout,
+		WriteTimeout: writeTimeout,
+	})
+}
+
+//minDuration treats the default and the disabled timeouts of the client as the longer ones
+func minDuration(a, b time.Duration) time.Duration {
+	if a <= 0 || b < a {
+		return b
 	}
+	return a
 }
@@ -0,0 +1,154 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"url-shortener/internal/storage/conformance"
+)
+
+func TestStorage(t *testing.T) {
+	mr, err := miniredis.Run()
+	require.NoError(t, err)
+	defer mr.Close()
+
+	s, err := NewStorage(&Config{
+		Address:          mr.Addr(),
+		InstanceIndexKey: "instance_index",
+		SlugIndexKey:     "slug_index",
+		FreeBlocksKey:    "free_slug_blocks",
+	})
+	require.NoError(t, err)
+	defer s.Close()
+
+	conformance.Run(t, func() (conformance.Backend, func(time.Duration)) {
+		mr.FlushAll()
+		return s, mr.FastForward
+	})
+}
+
+func TestNewStorage(t *testing.T) {
+	cases := []struct {
+		cfg    Config
+		client interface{}
+	}{
+		{Config{Address: "localhost:6379"}, &redis.Client{}},
+		{Config{Addresses: []string{"sentinel:26379"}, MasterName: "master"}, &redis.Client{}},
+		{Config{Addresses: []string{"node:6379"}, Cluster: true}, &redis.ClusterClient{}},
+	}
+	for _, c := range cases {
+		s, err := NewStorage(&c.cfg)
+		require.NoError(t, err)
+		assert.IsType(t, c.client, s.client)
+		assert.NoError(t, s.Close())
+	}
+
+	for _, cfg := range []Config{
+		{},
+		{MasterName: "master"},
+		{Cluster: true},
+		{Addresses: []string{"node:6379"}, Cluster: true, Database: 1},
+		{Addresses: []string{"node:6379"}, Cluster: true, MasterName: "master"},
+	} {
+		_, err := NewStorage(&cfg)
+		assert.Error(t, err)
+	}
+}
+
+func TestDeadlines(t *testing.T) {
+	//The server accepts the connections and never answers
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	newStorage := func(operationTimeout time.Duration, readTimeout time.Duration) *storage {
+		s, err := NewStorage(&Config{
+			Address:          listener.Addr().String(),
+			OperationTimeout: operationTimeout,
+			ReadTimeout:      readTimeout,
+		})
+		require.NoError(t, err)
+		return s
+	}
+
+	s := newStorage(50*time.Millisecond, time.Minute)
+	defer s.Close()
+	started := time.Now()
+	_, err = s.LoadValue(context.Background(), "key")
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	assert.True(t, time.Since(started) < time.Second)
+
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	s = newStorage(0, time.Minute)
+	defer s.Close()
+	err = s.SaveValue(ctx, "key", "value", 0)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	s = newStorage(0, 50*time.Millisecond)
+	defer s.Close()
+	err = s.SaveValue(ctx, "key", "value", 0)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	err = s.SaveValue(ctx, "key", "value", 0)
+	assert.True(t, errors.Is(err, context.Canceled))
+
+	s = newStorage(0, 50*time.Millisecond)
+	defer s.Close()
+	_, err = s.LoadValue(context.Background(), "key")
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+}
+
+func TestTakeToken(t *testing.T) {
+	mr, err := miniredis.Run()
+	require.NoError(t, err)
+	defer mr.Close()
+
+	s, err := NewStorage(&Config{Address: mr.Addr()})
+	require.NoError(t, err)
+	defer s.Close()
+
+	ctx := context.Background()
+	now := time.Date(2020, 3, 15, 10, 30, 0, 0, time.UTC)
+	take := func(at time.Time) (bool, float64) {
+		allowed, tokens, err := s.TakeToken(ctx, "ratelimit:create:ip:1.2.3.4", 0.5, 2, at)
+		require.NoError(t, err)
+		return allowed, tokens
+	}
+
+	allowed, tokens := take(now)
+	assert.True(t, allowed)
+	assert.Equal(t, float64(1), tokens)
+	allowed, tokens = take(now)
+	assert.True(t, allowed)
+	assert.Equal(t, float64(0), tokens)
+	allowed, tokens = take(now.Add(time.Second))
+	assert.False(t, allowed)
+	assert.Equal(t, 0.5, tokens)
+	allowed, tokens = take(now.Add(2 * time.Second))
+	assert.True(t, allowed)
+	assert.Equal(t, float64(0), tokens)
+
+	assert.True(t, mr.TTL("ratelimit:create:ip:1.2.3.4") > 0)
+}
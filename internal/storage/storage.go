@@ -1,8 +1,34 @@
 package storage
 
-import "context"
+import (
+	"context"
+	"errors"
+	"time"
+)
 
+var (
+	ErrNotFound      = errors.New("The value is not found")
+	ErrAlreadyExists = errors.New("The value already exists")
+	ErrValueChanged  = errors.New("The value has been changed")
+	ErrUnavailable   = errors.New("The storage is unavailable")
+)
+
+//Record is a value saved together with others, the zero expiration means that the value is kept forever
+type Record struct {
+	Key        string
+	Value      string
+	Expiration time.Duration
+}
+
+//The zero expiration means that the value is kept forever
 type Storage interface {
-	SaveValue(ctx context.Context, key string, value string) error
+	SaveValue(ctx context.Context, key string, value string, expiration time.Duration) error
+	//SaveValues saves all the records in one round trip
+	SaveValues(ctx context.Context, records []Record) error
+	//CreateValue saves the value only if the key doesn't exist yet, otherwise it fails with ErrAlreadyExists
+	CreateValue(ctx context.Context, key string, value string, expiration time.Duration) error
+	//UpdateValue replaces the value only if it's still equal to the previous one, otherwise it fails with
+	//ErrValueChanged or ErrNotFound
+	UpdateValue(ctx context.Context, key string, previous string, value string, expiration time.Duration) error
 	LoadValue(ctx context.Context, key string) (string, error)
 }
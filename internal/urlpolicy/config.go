@@ -0,0 +1,16 @@
+package urlpolicy
+
+import "time"
+
+type Config struct {
+	Schemes []string `env:"URLPOLICY_SCHEMES,default=http;https"`
+	//The hosts may start with *. to match all the subdomains, the allowed hosts aren't checked if they're empty
+	DeniedHosts  []string `env:"URLPOLICY_DENIEDHOSTS"`
+	AllowedHosts []string `env:"URLPOLICY_ALLOWEDHOSTS"`
+	//OwnHosts are the domains of the short links in addition to the host of the request, the links to them loop
+	OwnHosts     []string `env:"URLPOLICY_OWNHOSTS"`
+	BlockPrivate bool     `env:"URLPOLICY_BLOCKPRIVATE,default=true"`
+	//ResolveHosts checks the addresses of the hosts against the private networks too
+	ResolveHosts   bool          `env:"URLPOLICY_RESOLVEHOSTS,default=true"`
+	ResolveTimeout time.Duration `env:"URLPOLICY_RESOLVETIMEOUT,default=1s"`
+}
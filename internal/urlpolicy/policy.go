@@ -0,0 +1,274 @@
+package urlpolicy
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//Violation is the reason why the URL isn't accepted, the reasons are told apart by the clients
+type Violation struct {
+	Reason      string
+	description string
+}
+
+func (v *Violation) Error() string {
+	return v.description
+}
+
+var (
+	ErrSchemeNotAllowed = &Violation{Reason: "scheme_not_allowed", description: "The scheme of the URL isn't allowed"}
+	ErrMissingHost      = &Violation{Reason: "host_missing", description: "The URL must have a host"}
+	ErrHostDenied       = &Violation{Reason: "host_denied", description: "The host of the URL is denied"}
+	ErrHostNotAllowed   = &Violation{Reason: "host_not_allowed", description: "The host of the URL isn't allowed"}
+	ErrRedirectLoop     = &Violation{Reason: "redirect_loop", description: "The URL leads to the short links"}
+	ErrPrivateNetwork   = &Violation{Reason: "private_network", description: "The URL leads to a private network"}
+	ErrInvalidHost      = &Violation{Reason: "host_invalid", description: "The host of the URL is invalid"}
+	ErrUnresolvedHost   = &Violation{Reason: "host_unresolved", description: "The host of the URL cannot be resolved"}
+)
+
+//privateNetworks aren't reachable from the internet, the links to them probe the networks of the clients
+var privateNetworks = mustParseCIDRs(
+	"0.0.0.0/8",
+	"10.0.0.0/8",
+	"100.64.0.0/10",
+	"127.0.0.0/8",
+	"169.254.0.0/16",
+	"172.16.0.0/12",
+	"192.168.0.0/16",
+	"::/128",
+	"::1/128",
+	"fc00::/7",
+	"fe80::/10",
+)
+
+type resolver interface {
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+type policy struct {
+	schemes        map[string]bool
+	deniedHosts    []string
+	allowedHosts   []string
+	ownHosts       []string
+	blockPrivate   bool
+	resolver       resolver
+	resolveTimeout time.Duration
+}
+
+//Check accepts the URL if it may be shortened, ownHost is the host which the short links are served from
+func (p *policy) Check(ctx context.Context, rawURL string, ownHost string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	if !p.schemes[strings.ToLower(u.Scheme)] {
+		return fmt.Errorf("%w: %s", ErrSchemeNotAllowed, u.Scheme)
+	}
+	host := normalizeHost(u.Hostname())
+	if host == "" {
+		return ErrMissingHost
+	}
+
+	if matchHost(p.deniedHosts, host) {
+		return fmt.Errorf("%w: %s", ErrHostDenied, host)
+	}
+	if len(p.allowedHosts) > 0 && !matchHost(p.allowedHosts, host) {
+		return fmt.Errorf("%w: %s", ErrHostNotAllowed, host)
+	}
+	if host == normalizeHost(stripPort(ownHost)) || matchHost(p.ownHosts, host) {
+		return ErrRedirectLoop
+	}
+	if p.blockPrivate {
+		return p.checkAddresses(ctx, host)
+	}
+	return nil
+}
+
+//checkAddresses rejects the private IPs and the hosts resolved to them. The hosts which cannot be resolved are
+//rejected too, since they may be resolved to the private IPs by the time the link is opened.
+func (p *policy) checkAddresses(ctx context.Context, host string) error {
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return fmt.Errorf("%w: %s", ErrPrivateNetwork, host)
+	}
+	ip, err := parseIP(host)
+	if err != nil {
+		return err
+	}
+	if ip != nil {
+		if isPrivate(ip) {
+			return fmt.Errorf("%w: %s is %s", ErrPrivateNetwork, host, ip)
+		}
+		return nil
+	}
+	if p.resolver == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, p.resolveTimeout)
+	defer cancel()
+	addresses, err := p.resolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrUnresolvedHost, err)
+	}
+	if len(addresses) == 0 {
+		return fmt.Errorf("%w: %s has no addresses", ErrUnresolvedHost, host)
+	}
+	for _, address := range addresses {
+		if isPrivate(address.IP) {
+			return fmt.Errorf("%w: %s is %s", ErrPrivateNetwork, host, address.IP)
+		}
+	}
+	return nil
+}
+
+//parseIP returns nil if the host is a name. Besides the usual notations it understands the IPv4 forms which the
+//browsers and inet_aton accept, such as 2130706433, 0x7f.1, 127.1 and 017700000001, so they aren't mistaken
+//for the names. The hosts ending with a number are IPv4 for the browsers, so they fail if they cannot be parsed.
+func parseIP(host string) (net.IP, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return ip, nil
+	}
+
+	parts := strings.Split(host, ".")
+	if !isIPv4Part(parts[len(parts)-1]) {
+		return nil, nil
+	}
+	if len(parts) > 4 {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidHost, host)
+	}
+	numbers := make([]uint64, 0, len(parts))
+	for _, part := range parts {
+		number, err := parseIPv4Part(part)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidHost, host)
+		}
+		numbers = append(numbers, number)
+	}
+
+	// All the parts except the last one are bytes, the last one fills the rest of the address
+	var address uint64
+	for i, number := range numbers[:len(numbers)-1] {
+		if number > 0xff {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidHost, host)
+		}
+		address |= number << (8 * uint(3-i))
+	}
+	last := numbers[len(numbers)-1]
+	if last >= 1<<(8*uint(5-len(numbers))) {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidHost, host)
+	}
+	address |= last
+	return net.IPv4(byte(address>>24), byte(address>>16), byte(address>>8), byte(address)), nil
+}
+
+//isIPv4Part reports whether the part of the host looks like a decimal or a hexadecimal 0x number
+func isIPv4Part(part string) bool {
+	digits := "0123456789"
+	if strings.HasPrefix(part, "0x") {
+		digits, part = "0123456789abcdef", part[2:]
+	} else if part == "" {
+		return false
+	}
+	for _, c := range part {
+		if !strings.ContainsRune(digits, c) {
+			return false
+		}
+	}
+	return true
+}
+
+//parseIPv4Part parses the decimal, the hexadecimal 0x and the octal 0 numbers
+func parseIPv4Part(part string) (uint64, error) {
+	switch {
+	case strings.HasPrefix(part, "0x"):
+		if part == "0x" {
+			return 0, nil
+		}
+		return strconv.ParseUint(part[2:], 16, 64)
+	case len(part) > 1 && strings.HasPrefix(part, "0"):
+		return strconv.ParseUint(part[1:], 8, 64)
+	}
+	return strconv.ParseUint(part, 10, 64)
+}
+
+func isPrivate(ip net.IP) bool {
+	for _, network := range privateNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+//matchHost supports the patterns like *.example.com, which match the subdomains but not example.com itself
+func matchHost(patterns []string, host string) bool {
+	for _, pattern := range patterns {
+		if strings.HasPrefix(pattern, "*.") {
+			if strings.HasSuffix(host, pattern[1:]) {
+				return true
+			}
+			continue
+		}
+		if host == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+func normalizeHost(host string) string {
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
+
+func stripPort(hostport string) string {
+	if host, _, err := net.SplitHostPort(hostport); err == nil {
+		return host
+	}
+	return hostport
+}
+
+func normalizeHosts(hosts []string) []string {
+	normalized := make([]string, 0, len(hosts))
+	for _, host := range hosts {
+		if host = normalizeHost(strings.TrimSpace(host)); host != "" {
+			normalized = append(normalized, host)
+		}
+	}
+	return normalized
+}
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
+
+func NewPolicy(cfg *Config) *policy {
+	schemes := make(map[string]bool, len(cfg.Schemes))
+	for _, scheme := range cfg.Schemes {
+		schemes[strings.ToLower(scheme)] = true
+	}
+	p := &policy{
+		schemes:      schemes,
+		deniedHosts:  normalizeHosts(cfg.DeniedHosts),
+		allowedHosts: normalizeHosts(cfg.AllowedHosts),
+		ownHosts:     normalizeHosts(cfg.OwnHosts),
+		blockPrivate: cfg.BlockPrivate,
+	}
+	if cfg.ResolveHosts {
+		p.resolver = net.DefaultResolver
+		p.resolveTimeout = cfg.ResolveTimeout
+	}
+	return p
+}
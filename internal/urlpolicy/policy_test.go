@@ -0,0 +1,179 @@
+package urlpolicy
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeResolver map[string][]string
+
+func (r fakeResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	ips, ok := r[host]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	addresses := make([]net.IPAddr, 0, len(ips))
+	for _, ip := range ips {
+		addresses = append(addresses, net.IPAddr{IP: net.ParseIP(ip)})
+	}
+	return addresses, nil
+}
+
+func TestPolicy(t *testing.T) {
+	ctx := context.Background()
+
+	Convey("Test the URL policy", t, func() {
+		cfg := &Config{
+			Schemes:        []string{"http", "HTTPS"},
+			DeniedHosts:    []string{"evil.com", "*.bad.net"},
+			OwnHosts:       []string{"sho.rt"},
+			BlockPrivate:   true,
+			ResolveTimeout: time.Second,
+		}
+		resolver := fakeResolver{
+			"example.com":     {"93.184.216.34"},
+			"bad.net":         {"93.184.216.34"},
+			"www.example.net": {"93.184.216.34"},
+			"internal.corp":   {"93.184.216.34", "10.1.2.3"},
+		}
+		newPolicy := func() *policy {
+			p := NewPolicy(cfg)
+			p.resolver = resolver
+			return p
+		}
+		check := func(url string) error {
+			return newPolicy().Check(ctx, url, "links.example.org:8080")
+		}
+
+		Convey("It accepts the public URLs", func() {
+			assert.NoError(t, check("https://example.com/path?query=1"))
+			assert.NoError(t, check("HTTP://Example.COM./"))
+			assert.NoError(t, check("http://bad.net/"))
+			assert.NoError(t, check("http://1572395042/"))
+		})
+
+		Convey("It rejects the schemes which aren't allowed", func() {
+			for _, url := range []string{"javascript:alert(1)", "file:///etc/passwd", "data:text/html,hi", "ftp://example.com"} {
+				assert.True(t, errors.Is(check(url), ErrSchemeNotAllowed), url)
+			}
+		})
+
+		Convey("It rejects the URLs without a host", func() {
+			assert.True(t, errors.Is(check("http:///path"), ErrMissingHost))
+		})
+
+		Convey("It rejects the denied hosts", func() {
+			assert.True(t, errors.Is(check("http://evil.com/"), ErrHostDenied))
+			assert.True(t, errors.Is(check("http://EVIL.com./"), ErrHostDenied))
+			assert.True(t, errors.Is(check("http://a.b.bad.net/"), ErrHostDenied))
+		})
+
+		Convey("It accepts only the allowed hosts if there are any", func() {
+			cfg.AllowedHosts = []string{"example.com", "*.example.net"}
+
+			assert.NoError(t, check("http://example.com/"))
+			assert.NoError(t, check("http://www.example.net/"))
+			assert.True(t, errors.Is(check("http://example.net/"), ErrHostNotAllowed))
+			assert.True(t, errors.Is(check("http://evil.com/"), ErrHostDenied))
+		})
+
+		Convey("It rejects the links to the short links", func() {
+			assert.True(t, errors.Is(check("http://links.example.org/abc"), ErrRedirectLoop))
+			assert.True(t, errors.Is(check("https://SHO.RT:443/abc"), ErrRedirectLoop))
+		})
+
+		Convey("It rejects the private networks", func() {
+			for _, url := range []string{
+				"http://localhost:8080/",
+				"http://api.localhost/",
+				"http://127.0.0.1/",
+				"http://10.0.0.1/",
+				"http://192.168.1.1/",
+				"http://169.254.169.254/latest/meta-data",
+				"http://[::1]/",
+				"http://[::ffff:127.0.0.1]/",
+				"http://[fd00::1]/",
+				"http://internal.corp/",
+				"http://2130706433/",
+				"http://0x7f.1/",
+				"http://127.1/",
+				"http://017700000001/",
+				"http://0x7F000001/",
+				"http://0177.0.0.1/",
+				"http://10.0x1.1/",
+				"http://0/",
+			} {
+				err := check(url)
+				assert.True(t, errors.Is(err, ErrPrivateNetwork), url)
+				violation := &Violation{}
+				assert.True(t, errors.As(err, &violation), url)
+				assert.Equal(t, "private_network", violation.Reason)
+			}
+		})
+
+		Convey("It parses the numeric IPv4 forms the way the browsers do", func() {
+			for host, expected := range map[string]string{
+				"2130706433":   "127.0.0.1",
+				"0x7f.1":       "127.0.0.1",
+				"127.1":        "127.0.0.1",
+				"017700000001": "127.0.0.1",
+				"192.168.257":  "192.168.1.1",
+				"010.0.0.1":    "8.0.0.1",
+				"0x.0x.0x.0x":  "0.0.0.0",
+				"1.2.3.4":      "1.2.3.4",
+			} {
+				ip, err := parseIP(host)
+				assert.NoError(t, err, host)
+				assert.Equal(t, expected, ip.String(), host)
+			}
+			for _, host := range []string{"example.com", "1.example.com", "0x7f.example"} {
+				ip, err := parseIP(host)
+				assert.NoError(t, err, host)
+				assert.Nil(t, ip, host)
+			}
+		})
+
+		Convey("It rejects the invalid numeric hosts", func() {
+			for _, url := range []string{
+				"http://4294967296/",
+				"http://256.1.1.1/",
+				"http://1.2.3.4.5/",
+				"http://1.2.65536/",
+				"http://08.1.1.1/",
+				"http://example.123/",
+				"http://99999999999999999999999/",
+			} {
+				assert.True(t, errors.Is(check(url), ErrInvalidHost), url)
+			}
+		})
+
+		Convey("It rejects the hosts which cannot be resolved", func() {
+			err := check("http://unknown.example.net/")
+
+			assert.True(t, errors.Is(err, ErrUnresolvedHost))
+			violation := &Violation{}
+			assert.True(t, errors.As(err, &violation))
+			assert.Equal(t, "host_unresolved", violation.Reason)
+		})
+
+		Convey("It doesn't resolve the hosts if it's disabled", func() {
+			p := NewPolicy(cfg)
+
+			assert.Nil(t, p.resolver)
+			assert.NoError(t, p.Check(ctx, "http://internal.corp/", ""))
+		})
+
+		Convey("It allows the private networks if they aren't blocked", func() {
+			cfg.BlockPrivate = false
+
+			assert.NoError(t, check("http://127.0.0.1/"))
+			assert.NoError(t, check("http://internal.corp/"))
+		})
+	})
+}
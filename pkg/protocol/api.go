@@ -4,6 +4,7 @@ import (
 	"errors"
 	"net/http"
 	"net/url"
+	"time"
 )
 
 type ErrorResponse struct {
@@ -16,8 +17,27 @@ type GeneralResponse struct {
 
 ///////////////////////////////////////////////////////////////////////////////
 
+//IsRedirectCode reports whether the status code may be used to redirect to the original URLs
+func IsRedirectCode(code int) bool {
+	switch code {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+	return false
+}
+
+//IdempotencyKeyHeader identifies the request to POST /, its replays are answered with the original slug
+const IdempotencyKeyHeader = "Idempotency-Key"
+
 type CreateShortLinkRequest struct {
-	URL string `json:"url"`
+	URL          string     `json:"url"`
+	Slug         string     `json:"slug,omitempty"`
+	ExpiresIn    int64      `json:"expires_in,omitempty"` // seconds
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+	RedirectCode int        `json:"redirect_code,omitempty"`
+	Tags         []string   `json:"tags,omitempty"`
+	//Dedupe asks to return the slug of the link created for the same URL with this option before
+	Dedupe bool `json:"dedupe,omitempty"`
 }
 
 func (c *CreateShortLinkRequest) Bind(r *http.Request) error {
@@ -27,11 +47,99 @@ func (c *CreateShortLinkRequest) Bind(r *http.Request) error {
 	if _, err := url.ParseRequestURI(c.URL); err != nil {
 		return err
 	}
+	if c.ExpiresIn < 0 {
+		return errors.New("The expires_in mustn't be negative")
+	}
+	if c.ExpiresIn != 0 && c.ExpiresAt != nil {
+		return errors.New("Only one of expires_in and expires_at may be set")
+	}
+	if c.RedirectCode != 0 && !IsRedirectCode(c.RedirectCode) {
+		return errors.New("The redirect code must be one of 301, 302, 307 and 308")
+	}
+	if c.Dedupe && c.Slug != "" {
+		return errors.New("Only one of slug and dedupe may be set")
+	}
 	return nil
 }
 
+//Expiration returns the moment when the link expires, the zero time means never
+func (c *CreateShortLinkRequest) Expiration(now time.Time) time.Time {
+	switch {
+	case c.ExpiresIn > 0:
+		return now.Add(time.Duration(c.ExpiresIn) * time.Second)
+	case c.ExpiresAt != nil:
+		return *c.ExpiresAt
+	}
+	return time.Time{}
+}
+
 type CreateShortLinkResponse struct {
 	Data struct {
 		Slug string `json:"slug"`
 	} `json:"data"`
 }
+
+//CreateShortLinkResult is either the slug of the created link or the errors which prevented creating it
+type CreateShortLinkResult struct {
+	Slug string `json:"slug,omitempty"`
+	ErrorResponse
+}
+
+//CreateShortLinksResponse keeps the results in the order of the requests of the batch
+type CreateShortLinksResponse struct {
+	Data []CreateShortLinkResult `json:"data"`
+}
+
+type ShortLinkStats struct {
+	Last24Hours int64 `json:"last_24_hours"`
+	LastWeek    int64 `json:"last_week"`
+	AllTime     int64 `json:"all_time"`
+}
+
+type GetShortLinkStatsResponse struct {
+	Data ShortLinkStats `json:"data"`
+}
+
+type ShortLink struct {
+	Slug         string          `json:"slug"`
+	URL          string          `json:"url"`
+	CreatedAt    *time.Time      `json:"created_at,omitempty"`
+	UpdatedAt    *time.Time      `json:"updated_at,omitempty"`
+	ExpiresAt    *time.Time      `json:"expires_at,omitempty"`
+	RedirectCode int             `json:"redirect_code"`
+	Tags         []string        `json:"tags,omitempty"`
+	Creator      string          `json:"creator,omitempty"`
+	Disabled     bool            `json:"disabled,omitempty"`
+	Hits         *ShortLinkStats `json:"hits,omitempty"`
+}
+
+type GetShortLinkResponse struct {
+	Data ShortLink `json:"data"`
+}
+
+type UpdateShortLinkRequest struct {
+	URL          *string `json:"url,omitempty"`
+	RedirectCode *int    `json:"redirect_code,omitempty"`
+}
+
+func (u *UpdateShortLinkRequest) Bind(r *http.Request) error {
+	if u.URL == nil && u.RedirectCode == nil {
+		return errors.New("Nothing to update")
+	}
+	if u.URL != nil {
+		if *u.URL == "" {
+			return errors.New("The URL mustn't be empty")
+		}
+		if _, err := url.ParseRequestURI(*u.URL); err != nil {
+			return err
+		}
+	}
+	if u.RedirectCode != nil && !IsRedirectCode(*u.RedirectCode) {
+		return errors.New("The redirect code must be one of 301, 302, 307 and 308")
+	}
+	return nil
+}
+
+type UpdateShortLinkResponse struct {
+	Data ShortLink `json:"data"`
+}
@@ -1,12 +1,25 @@
 package protocol
 
 import (
+	"errors"
+	"net/url"
 	"testing"
+	"time"
 
 	. "github.com/smartystreets/goconvey/convey"
 	"github.com/stretchr/testify/assert"
 )
 
+//assertParseError checks the stable parts of the error of the URL parser, its message depends on the version of Go
+func assertParseError(t *testing.T, err error, rawURL string) {
+	urlErr := &url.Error{}
+	if assert.True(t, errors.As(err, &urlErr), "%v isn't a URL error", err) {
+		assert.Equal(t, "parse", urlErr.Op)
+		assert.Equal(t, rawURL, urlErr.URL)
+		assert.Error(t, urlErr.Err)
+	}
+}
+
 func TestCreateShortLinkRequest(t *testing.T) {
 	Convey("Test validation", t, func() {
 		r := CreateShortLinkRequest{}
@@ -19,11 +32,101 @@ func TestCreateShortLinkRequest(t *testing.T) {
 		Convey("It fails if the URL is incorrect", func() {
 			r.URL = "htt ttps://amazon.com"
 			err := r.Bind(nil)
-			assert.EqualError(t, err, "parse htt ttps://amazon.com: invalid URI for request")
+			assertParseError(t, err, "htt ttps://amazon.com")
+		})
+
+		Convey("It fails if expires_in is negative", func() {
+			r.URL = "https://amazon.com"
+			r.ExpiresIn = -1
+			err := r.Bind(nil)
+			assert.EqualError(t, err, "The expires_in mustn't be negative")
+		})
+
+		Convey("It fails if both expires_in and expires_at are set", func() {
+			r.URL = "https://amazon.com"
+			r.ExpiresIn = 60
+			r.ExpiresAt = &time.Time{}
+			err := r.Bind(nil)
+			assert.EqualError(t, err, "Only one of expires_in and expires_at may be set")
+		})
+
+		Convey("It fails if a custom slug is deduplicated", func() {
+			r.URL = "https://amazon.com"
+			r.Slug = "amazon"
+			r.Dedupe = true
+			err := r.Bind(nil)
+			assert.EqualError(t, err, "Only one of slug and dedupe may be set")
+		})
+
+		Convey("It fails if the redirect code is not a redirect", func() {
+			r.URL = "https://amazon.com"
+			r.RedirectCode = 200
+			err := r.Bind(nil)
+			assert.EqualError(t, err, "The redirect code must be one of 301, 302, 307 and 308")
 		})
 
 		Convey("It doesn't return any errors if everything is fine", func() {
 			r.URL = "https://amazon.com"
+			r.RedirectCode = 307
+			err := r.Bind(nil)
+			assert.NoError(t, err)
+		})
+	})
+}
+
+func TestCreateShortLinkRequestExpiration(t *testing.T) {
+	now := time.Date(2020, 3, 15, 10, 30, 0, 0, time.UTC)
+	at := time.Date(2020, 4, 1, 0, 0, 0, 0, time.UTC)
+
+	assert.True(t, (&CreateShortLinkRequest{}).Expiration(now).IsZero())
+	assert.Equal(t, now.Add(time.Hour), (&CreateShortLinkRequest{ExpiresIn: 3600}).Expiration(now))
+	assert.Equal(t, at, (&CreateShortLinkRequest{ExpiresAt: &at}).Expiration(now))
+}
+
+func TestIsRedirectCode(t *testing.T) {
+	for _, code := range []int{301, 302, 307, 308} {
+		assert.True(t, IsRedirectCode(code), code)
+	}
+	for _, code := range []int{0, 200, 303, 404} {
+		assert.False(t, IsRedirectCode(code), code)
+	}
+}
+
+func TestUpdateShortLinkRequest(t *testing.T) {
+	Convey("Test validation", t, func() {
+		r := UpdateShortLinkRequest{}
+
+		Convey("It fails if there is nothing to update", func() {
+			err := r.Bind(nil)
+			assert.EqualError(t, err, "Nothing to update")
+		})
+
+		Convey("It fails if the URL is empty", func() {
+			url := ""
+			r.URL = &url
+			err := r.Bind(nil)
+			assert.EqualError(t, err, "The URL mustn't be empty")
+		})
+
+		Convey("It fails if the URL is incorrect", func() {
+			url := "htt ttps://amazon.com"
+			r.URL = &url
+			err := r.Bind(nil)
+			assertParseError(t, err, "htt ttps://amazon.com")
+		})
+
+		Convey("It fails if the redirect code is not a redirect", func() {
+			code := 200
+			r.RedirectCode = &code
+			err := r.Bind(nil)
+			assert.EqualError(t, err, "The redirect code must be one of 301, 302, 307 and 308")
+		})
+
+		Convey("It doesn't return any errors if everything is fine", func() {
+			url := "https://amazon.com"
+			code := 302
+			r.URL = &url
+			r.RedirectCode = &code
 			err := r.Bind(nil)
 			assert.NoError(t, err)
 		})
@@ -3,4 +3,6 @@ package protocol
 type Error struct {
 	Description string `json:"description"`
 	Code        int32  `json:"code"`
+	//Reason tells apart the errors with the same code
+	Reason string `json:"reason,omitempty"`
 }
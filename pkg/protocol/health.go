@@ -0,0 +1,17 @@
+package protocol
+
+const (
+	HealthStatusOK           = "ok"
+	HealthStatusFailed       = "failed"
+	HealthStatusShuttingDown = "shutting_down"
+)
+
+type DependencyHealth struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type HealthResponse struct {
+	Status       string                      `json:"status"`
+	Dependencies map[string]DependencyHealth `json:"dependencies,omitempty"`
+}